@@ -2,7 +2,10 @@ package command
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 )
 
@@ -21,11 +24,57 @@ type Command struct {
 
 	Name      string
 	Arguments []string
+
+	// keyword arguments like lines=10-80 by name. nil if there are none
+	Keywords map[string]string
 }
 
+// String formats the command so that parsing it gives the same command.
+// Arguments are quoted when they need to be and keyword arguments follow
+// the positional ones sorted by name.
 func (c Command) String() string {
-	args := strings.Join(c.Arguments, ", ")
-	return fmt.Sprintf("@%s(%s)", c.Name, args)
+	args := make([]string, 0, len(c.Arguments)+len(c.Keywords))
+	for _, arg := range c.Arguments {
+		args = append(args, quoteArgument(arg))
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Keywords)) {
+		args = append(args, name+"="+quoteArgument(c.Keywords[name]))
+	}
+	return fmt.Sprintf("@%s(%s)", c.Name, strings.Join(args, ", "))
+}
+
+func quoteArgument(arg string) string {
+	if !needsQuotes(arg) {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+// needsQuotes reports whether arg wouldn't be parsed back as itself
+// without quotes
+func needsQuotes(arg string) bool {
+	if strings.TrimSpace(arg) != arg || strings.HasPrefix(arg, `"`) {
+		return true
+	}
+	if name, _, ok := strings.Cut(arg, "="); ok && isName(name) {
+		return true
+	}
+	depth := 0
+	for _, ch := range arg {
+		switch ch {
+		case ',', '\\':
+			return true
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return true
+			}
+		}
+	}
+	return depth != 0
 }
 
 func NewCommand(name string, arguments []string, start, end int) Command {
@@ -36,8 +85,38 @@ func NewCommand(name string, arguments []string, start, end int) Command {
 	}
 }
 
-func Parse(str []byte) []Command {
+// Diagnostic is a problem with a command in a prompt. It's found while
+// parsing so it can be shown before the prompt is sent.
+type Diagnostic struct {
+	Message string
+
+	// the part of the prompt the problem is with
+	Loc Range
+
+	// how it might be fixed e.g. did you mean @file? empty if there's
+	// nothing to suggest
+	Suggestion string
+}
+
+func (d Diagnostic) Error() string {
+	if d.Suggestion == "" {
+		return d.Message
+	}
+	return d.Message + ". " + d.Suggestion
+}
+
+// errNotCommand is returned by parseCommand when the '@' doesn't start a
+// command e.g. in an email address. it isn't a diagnostic since the user
+// didn't mean to write a command
+var errNotCommand = errors.New("Not a command")
+
+// Parse returns the commands in str and diagnostics for the ones that
+// couldn't be parsed. An '@' only starts a command when it's followed by a
+// name and '(' so mentions and email addresses are left alone. An '@'
+// can be escaped with a backslash.
+func Parse(str []byte) ([]Command, []Diagnostic) {
 	cmds := []Command{}
+	var diagnostics []Diagnostic
 
 	for i := 0; i < len(str); {
 		ch := str[i]
@@ -48,6 +127,10 @@ func Parse(str []byte) []Command {
 
 		cmd, n, err := parseCommand(str, i)
 		if err != nil {
+			var d Diagnostic
+			if errors.As(err, &d) {
+				diagnostics = append(diagnostics, d)
+			}
 			i += 1
 			continue
 		}
@@ -56,11 +139,14 @@ func Parse(str []byte) []Command {
 		cmds = append(cmds, cmd)
 	}
 
-	return cmds
+	return cmds, diagnostics
 }
 
-// n is the amount of characters read for the entire command
+// n is the amount of characters read for the entire command. Syntax errors
+// are returned as a Diagnostic, errors without a position of their own
+// cover the command from its '@' to the end of str
 func parseCommand(b []byte, start int) (command Command, n int, err error) {
+	str := b
 	b = b[start:]
 	if b[0] != '@' {
 		return Command{}, 0, fmt.Errorf(
@@ -68,48 +154,203 @@ func parseCommand(b []byte, start int) (command Command, n int, err error) {
 			string(b),
 		)
 	}
-	commandName, err := readUntil(b[1:], '(')
-	if err != nil {
-		return Command{}, 0, fmt.Errorf("Expected '('")
-	}
 
-	nameLen := len(commandName)
+	nameLen := bytes.IndexFunc(b[1:], func(r rune) bool {
+		return !isNameChar(r)
+	})
+	if nameLen <= 0 || b[1+nameLen] != '(' || !isName(string(b[1:1+nameLen])) {
+		return Command{}, 0, errNotCommand
+	}
+	commandName := b[1 : 1+nameLen]
 
-	args, err := readUntil(b[nameLen+2:], ')')
+	commandArgs, keywords, argsLen, err := parseArguments(b[nameLen+2:])
 	if err != nil {
-		return Command{}, 0, fmt.Errorf("Expected ')'")
+		var d Diagnostic
+		if !errors.As(err, &d) {
+			return Command{}, 0, Diagnostic{
+				Message:    err.Error(),
+				Loc:        Range{Start: start, End: len(str)},
+				Suggestion: "close it with ')' or escape the @ with \\@ if it isn't a command",
+			}
+		}
+		offset := start + nameLen + 2
+		d.Loc = Range{Start: d.Loc.Start + offset, End: d.Loc.End + offset}
+		return Command{}, 0, d
 	}
-	commandArgs := parseArguments(args)
 
-	// 3 represents '@' + '(' + ')'
-	n = len(args) + nameLen + 3
-	return NewCommand(string(commandName), commandArgs, start, n+start), n, nil
+	// 2 represents '@' + '('. argsLen includes ')'
+	n = nameLen + 2 + argsLen
+	command = NewCommand(string(commandName), commandArgs, start, n+start)
+	command.Keywords = keywords
+	return command, n, nil
 }
 
-func parseArguments(args []byte) []string {
-	if len(args) == 0 {
-		return []string{""}
+// parseArguments reads the comma separated arguments after a command's
+// '(' up to and including its ')'. n is the number of bytes read.
+//
+// Arguments are trimmed unless they're quoted. Inside quotes commas and
+// parentheses are plain characters and \" and \\ are escapes. Outside of
+// quotes \, \( \) \" \= and \\ are escapes and any other backslash is
+// kept as is so paths like C:\notes\a.md work. parentheses only have to be
+// escaped when they aren't balanced, so @link(https://x.com/a_(b)) works as
+// is.
+//
+// An argument that starts with a name and '=' is a keyword argument e.g.
+// lines=10-80. Its value can be quoted like any other argument.
+//
+// Errors that point at part of the arguments are a Diagnostic with a Loc
+// relative to b.
+func parseArguments(b []byte) (args []string, keywords map[string]string, n int, err error) {
+	var (
+		arg strings.Builder
+
+		// unescaped whitespace at the end of arg that's trimmed unless
+		// more of the argument follows
+		space strings.Builder
+
+		// name of the keyword argument that's being read
+		key string
+
+		depth   int
+		quoted  bool
+		escaped bool
+
+		// set once a quoted argument's closing quote was read. only
+		// whitespace may follow it
+		closed bool
+
+		// where the argument that's being read and its quote start
+		argStart, quoteStart int
+	)
+
+	// end is where the argument ends in b
+	finish := func(end int) error {
+		defer func() {
+			arg.Reset()
+			space.Reset()
+			key = ""
+			escaped = false
+			closed = false
+		}()
+
+		if key == "" {
+			args = append(args, arg.String())
+			return nil
+		}
+		if _, ok := keywords[key]; ok {
+			return Diagnostic{
+				Message:    fmt.Sprintf("The argument %q is given more than once", key),
+				Loc:        Range{Start: argStart, End: end},
+				Suggestion: "remove one of them",
+			}
+		}
+		if keywords == nil {
+			keywords = map[string]string{}
+		}
+		keywords[key] = arg.String()
+		return nil
+	}
+
+	for i := 0; i < len(b); i++ {
+		ch := b[i]
+
+		if quoted {
+			switch {
+			case ch == '\\' && i+1 < len(b) && (b[i+1] == '"' || b[i+1] == '\\'):
+				i++
+				arg.WriteByte(b[i])
+			case ch == '"':
+				quoted = false
+				closed = true
+			default:
+				arg.WriteByte(ch)
+			}
+			continue
+		}
+
+		switch {
+		case ch == ')' && depth == 0:
+			if len(args) == 0 && keywords == nil && key == "" && arg.Len() == 0 && !closed {
+				// @name() has no arguments rather than an empty one
+				return nil, nil, i + 1, nil
+			}
+			if err := finish(i); err != nil {
+				return nil, nil, 0, err
+			}
+			return args, keywords, i + 1, nil
+
+		case ch == ',' && depth == 0:
+			if err := finish(i); err != nil {
+				return nil, nil, 0, err
+			}
+			argStart = i + 1
+
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			if arg.Len() > 0 && !closed {
+				space.WriteByte(ch)
+			}
+
+		case closed:
+			return nil, nil, 0, Diagnostic{
+				Message:    fmt.Sprintf("Expected ',' or ')' after a quoted argument got %q", ch),
+				Loc:        Range{Start: i, End: i + 1},
+				Suggestion: "put the whole argument in the quotes",
+			}
+
+		case ch == '"' && arg.Len() == 0:
+			quoted = true
+			quoteStart = i
+
+		case ch == '=' && key == "" && depth == 0 && !escaped && isName(arg.String()):
+			key = arg.String()
+			arg.Reset()
+			space.Reset()
+
+		case ch == '\\' && i+1 < len(b) && strings.IndexByte(`,()"=\`, b[i+1]) >= 0:
+			i++
+			escaped = true
+			arg.WriteString(space.String())
+			space.Reset()
+			arg.WriteByte(b[i])
+
+		default:
+			if ch == '(' {
+				depth++
+			} else if ch == ')' {
+				depth--
+			}
+			arg.WriteString(space.String())
+			space.Reset()
+			arg.WriteByte(ch)
+		}
 	}
 
-	split := bytes.Split(args, []byte(","))
-	ret := make([]string, len(split))
-	for i, b := range split {
-		ret[i] = string(bytes.TrimSpace(b))
+	if quoted {
+		return nil, nil, 0, Diagnostic{
+			Message:    "Expected '\"' to close the quoted argument",
+			Loc:        Range{Start: quoteStart, End: len(b)},
+			Suggestion: `close it with '"'`,
+		}
 	}
-	return ret
+	return nil, nil, 0, fmt.Errorf("Expected ')'")
 }
 
-// returns an error if the delimter was not found
-func readUntil(b []byte, delimiter byte) ([]byte, error) {
-	i := bytes.IndexByte(b, delimiter)
-	if i == -1 {
-		return nil, fmt.Errorf(
-			"Delimter %c not found in %s",
-			delimiter,
-			string(b),
-		)
+// isName reports whether s can be the name of a command or keyword argument
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, ch := range s {
+		if !isNameChar(ch) || i == 0 && ('0' <= ch && ch <= '9' || ch == '-') {
+			return false
+		}
 	}
-	return b[:i], nil
+	return true
+}
+
+func isNameChar(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' ||
+		ch == '_' || ch == '-'
 }
 
 // returns if i-1 is expected
@@ -119,3 +360,41 @@ func matchPrevious(b []byte, i int, expected byte) bool {
 	}
 	return false
 }
+
+// Suggest returns the name in names that's closest to name, for commands
+// that were misspelled. It returns an empty string if none of them are
+// close enough to be what was meant.
+func Suggest(name string, names []string) string {
+	// more than a couple of typos is probably a different word
+	best, bestDistance := "", min(2, len([]rune(name))-1)
+	for _, candidate := range names {
+		if d := distance(strings.ToLower(name), candidate); d <= bestDistance {
+			if d < bestDistance || best == "" {
+				best, bestDistance = candidate, d
+			}
+		}
+	}
+	return best
+}
+
+// distance is the levenshtein distance between a and b
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -2,6 +2,7 @@ package command
 
 import (
 	"fmt"
+	"maps"
 	"slices"
 	"strings"
 	"testing"
@@ -20,6 +21,10 @@ func TestParseCommands(t *testing.T) {
 			"\\@attach-file(file.txt)",
 			[]Command{},
 		},
+		{
+			"@text() @text( )",
+			[]Command{NewCommand("text", nil, 0, 7), NewCommand("text", nil, 8, 16)},
+		},
 		{
 			"@attach-file(file.txt) \\@attach-link(example.com)",
 			[]Command{NewCommand("attach-file", []string{"file.txt"}, 0, 22)},
@@ -98,7 +103,7 @@ and here's a markdown file @attach-markdown(input.md).
 
 	for i, tt := range tests {
 		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
-			cmds := Parse([]byte(tt.input))
+			cmds, _ := Parse([]byte(tt.input))
 			if len(cmds) != len(tt.expected) {
 				t.Fatalf(
 					"unequal number of commands: got=%d. expected=%d. commands=%s. expected=%s",
@@ -157,7 +162,7 @@ and here's a markdown file @attach-markdown(input.md).
 
 	for i, tt := range tests {
 		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
-			cmds := Parse([]byte(tt.input))
+			cmds, _ := Parse([]byte(tt.input))
 			if len(cmds) != len(tt.expected) {
 				t.Fatalf(
 					"unequal number of commands: got=%d. expected=%d. commands=%s. expected=%+v",
@@ -214,7 +219,7 @@ and here's a markdown file @attach-markdown(input.md).
 
 	for i, tt := range tests {
 		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
-			cmds := Parse([]byte(tt.input))
+			cmds, _ := Parse([]byte(tt.input))
 			for _, cmd := range cmds {
 				substr := tt.input[cmd.Loc.Start:cmd.Loc.End]
 				if s := cmd.String(); s != substr {
@@ -309,6 +314,14 @@ func testCommandEqual(t *testing.T, cmd Command, expected Command) bool {
 		)
 		return false
 	}
+	if !maps.Equal(cmd.Keywords, expected.Keywords) {
+		t.Errorf(
+			"unexpected keyword arguments. got=%v. expected=%v",
+			cmd.Keywords,
+			expected.Keywords,
+		)
+		return false
+	}
 	if cmd.Loc != expected.Loc {
 		t.Errorf(
 			"unequal Loc. got=%s. expected=%s",
@@ -318,3 +331,211 @@ func testCommandEqual(t *testing.T, cmd Command, expected Command) bool {
 	}
 	return true
 }
+
+func TestParseQuotedArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Command
+	}{
+		{
+			`@file(notes (draft).md)`,
+			[]Command{NewCommand("file", []string{"notes (draft).md"}, 0, 23)},
+		},
+		{
+			`see @link("https://x.com/?a=1,2", b.md) now`,
+			[]Command{NewCommand("link", []string{"https://x.com/?a=1,2", "b.md"}, 4, 39)},
+		},
+		{
+			`@link(https://en.wikipedia.org/wiki/Go_(programming_language))`,
+			[]Command{NewCommand("link", []string{"https://en.wikipedia.org/wiki/Go_(programming_language)"}, 0, 62)},
+		},
+		{
+			`@text("say \"hi\" \\ (", "  padded  ")`,
+			[]Command{NewCommand("text", []string{`say "hi" \ (`, "  padded  "}, 0, 38)},
+		},
+		{
+			`@file(a\,b.md, c\).md, d\\ )`,
+			[]Command{NewCommand("file", []string{"a,b.md", "c).md", `d\`}, 0, 28)},
+		},
+		// other backslashes aren't escapes
+		{
+			`@file(C:\notes\a.md, \d.md)`,
+			[]Command{NewCommand("file", []string{`C:\notes\a.md`, `\d.md`}, 0, 27)},
+		},
+		{
+			`@text("a", "b" , c d )`,
+			[]Command{NewCommand("text", []string{"a", "b", "c d"}, 0, 22)},
+		},
+		{
+			"héllo @text(\"ü,ö\")!",
+			[]Command{NewCommand("text", []string{"ü,ö"}, 7, 21)},
+		},
+		// unbalanced or unterminated commands aren't commands
+		{`@file(notes (draft.md)`, []Command{}},
+		{`@text("a) @text(b)`, []Command{NewCommand("text", []string{"b"}, 10, 18)}},
+		{`@text("a"b)`, []Command{}},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			cmds, _ := Parse([]byte(tt.input))
+			if len(cmds) != len(tt.expected) {
+				t.Fatalf(
+					"unequal number of commands: got=%d. expected=%d. commands=%s",
+					len(cmds),
+					len(tt.expected),
+					commandSliceString(cmds),
+				)
+			}
+			for i := range cmds {
+				_ = testCommandEqual(t, cmds[i], tt.expected[i])
+
+				// String has to give back the same command
+				again, _ := Parse([]byte(cmds[i].String()))
+				if len(again) != 1 || !slices.Equal(again[0].Arguments, cmds[i].Arguments) {
+					t.Errorf("%s doesn't parse back to itself. got=%s", cmds[i], commandSliceString(again))
+				}
+			}
+		})
+	}
+}
+
+func TestParseKeywordArguments(t *testing.T) {
+	withKeywords := func(cmd Command, keywords map[string]string) Command {
+		cmd.Keywords = keywords
+		return cmd
+	}
+
+	tests := []struct {
+		input    string
+		expected []Command
+	}{
+		{
+			"@file(main.go, lines=10-80)",
+			[]Command{withKeywords(
+				NewCommand("file", []string{"main.go"}, 0, 27),
+				map[string]string{"lines": "10-80"},
+			)},
+		},
+		{
+			"@link(https://x.com/?a=1, mode = text, max=20kb)",
+			[]Command{withKeywords(
+				NewCommand("link", []string{"https://x.com/?a=1"}, 0, 48),
+				map[string]string{"mode": "text", "max": "20kb"},
+			)},
+		},
+		{
+			`@file(lines=1-2, title="a, b", "c=d.md", e\=f.md)`,
+			[]Command{withKeywords(
+				NewCommand("file", []string{"c=d.md", "e=f.md"}, 0, 49),
+				map[string]string{"lines": "1-2", "title": "a, b"},
+			)},
+		},
+		{
+			"@text(empty=)",
+			[]Command{withKeywords(
+				NewCommand("text", nil, 0, 13),
+				map[string]string{"empty": ""},
+			)},
+		},
+		// a keyword can only be given once
+		{"@file(a.md, max=1, max=2)", []Command{}},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			cmds, _ := Parse([]byte(tt.input))
+			if len(cmds) != len(tt.expected) {
+				t.Fatalf(
+					"unequal number of commands: got=%d. expected=%d. commands=%s",
+					len(cmds),
+					len(tt.expected),
+					commandSliceString(cmds),
+				)
+			}
+			for i := range cmds {
+				_ = testCommandEqual(t, cmds[i], tt.expected[i])
+
+				again, _ := Parse([]byte(cmds[i].String()))
+				if len(again) != 1 || !maps.Equal(again[0].Keywords, cmds[i].Keywords) ||
+					!slices.Equal(again[0].Arguments, cmds[i].Arguments) {
+					t.Errorf("%s doesn't parse back to itself. got=%s", cmds[i], commandSliceString(again))
+				}
+			}
+		})
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		commands int
+		expected []Diagnostic
+	}{
+		{"email me at a@b.com (or @someone)", 0, nil},
+		{"\\@file(a.md", 0, nil},
+		{
+			"see @file(a.md",
+			0,
+			[]Diagnostic{{Message: "Expected ')'", Loc: Range{Start: 4, End: 14}}},
+		},
+		{
+			`@file("a.md) @link(b.com)`,
+			1,
+			[]Diagnostic{{Message: `Expected '"' to close the quoted argument`, Loc: Range{Start: 6, End: 25}}},
+		},
+		{
+			`@file("a.md" x)`,
+			0,
+			[]Diagnostic{{Message: `Expected ',' or ')' after a quoted argument got 'x'`, Loc: Range{Start: 13, End: 14}}},
+		},
+		{
+			"@file(a.md, max=1, max=2)",
+			0,
+			[]Diagnostic{{Message: `The argument "max" is given more than once`, Loc: Range{Start: 18, End: 24}}},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			cmds, diagnostics := Parse([]byte(tt.input))
+			if len(cmds) != tt.commands {
+				t.Errorf("got=%d commands. expected=%d", len(cmds), tt.commands)
+			}
+			if len(diagnostics) != len(tt.expected) {
+				t.Fatalf("got=%+v. expected=%+v", diagnostics, tt.expected)
+			}
+			for i, d := range diagnostics {
+				if d.Message != tt.expected[i].Message || d.Loc != tt.expected[i].Loc {
+					t.Errorf("got=%+v. expected=%+v", d, tt.expected[i])
+				}
+				if d.Suggestion == "" {
+					t.Errorf("%q has no suggestion", d.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	names := []string{"attach-file", "file", "attach-link", "link", "text"}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"fiel", "file"},
+		{"File", "file"},
+		{"attach-fle", "attach-file"},
+		{"lnk", "link"},
+		{"image", ""},
+		{"x", ""},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			if got := Suggest(tt.name, names); got != tt.expected {
+				t.Errorf("got=%q. expected=%q", got, tt.expected)
+			}
+		})
+	}
+}
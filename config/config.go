@@ -0,0 +1,165 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+)
+
+// Config holds everything needed to start a session. Values are read
+// from the config file, then the environment and finally command line
+// flags, with later sources taking precedence.
+type Config struct {
+	// ollama or openai
+	Backend string `json:"backend,omitempty"`
+
+	// base url of the model server. empty means the backend's default
+	URL string `json:"url,omitempty"`
+
+	// bearer token sent with every request
+	Token string `json:"token,omitempty"`
+
+	// extra headers sent with every request
+	Headers map[string]string `json:"headers,omitempty"`
+
+	Model string `json:"model,omitempty"`
+
+	// generation options e.g. {"temperature": 0.7, "num_ctx": 8192}
+	Options llm.Options `json:"options"`
+
+	SystemPrompt string `json:"system_prompt,omitempty"`
+
+	// tokens the history may take up before older messages are summarized.
+	// 0 means three quarters of num_ctx
+	TokenBudget int `json:"token_budget,omitempty"`
+
+	// name of the persona to start with. it takes precedence over Model,
+	// Options and SystemPrompt
+	Persona string `json:"persona,omitempty"`
+
+	// lets the model read files and fetch links on its own. every call is
+	// confirmed first
+	Tools bool `json:"tools,omitempty"`
+}
+
+func Default() Config {
+	return Config{
+		Backend: "ollama",
+		Model:   "mistral",
+	}
+}
+
+// Dir returns the directory research keeps its configuration in.
+// This is usually ~/.config/research
+func Dir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "research"), nil
+}
+
+// DataDir returns the directory research keeps its data in. This is
+// $XDG_DATA_HOME/research or ~/.local/share/research if it isn't set.
+func DataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "research"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "research"), nil
+}
+
+// SessionsDir returns the directory sessions are saved in.
+// This is usually ~/.local/share/research/sessions
+func SessionsDir() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sessions"), nil
+}
+
+// Path returns the default location of the config file.
+func Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// Load reads the config file at path on top of the defaults.
+// A missing file is not an error.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return Config{}, fmt.Errorf("Failed to parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ApplyEnv overrides c with values from the environment.
+// OLLAMA_HOST is used by the ollama backend and OPENAI_BASE_URL and
+// OPENAI_API_KEY by the openai backend.
+func (c *Config) ApplyEnv(getenv func(string) string) error {
+	switch c.Backend {
+	case "ollama":
+		if host := getenv("OLLAMA_HOST"); host != "" {
+			url, err := llm.ParseOllamaHost(host)
+			if err != nil {
+				return err
+			}
+			c.URL = url
+		}
+
+	case "openai":
+		if url := getenv("OPENAI_BASE_URL"); url != "" {
+			c.URL = url
+		}
+		if key := getenv("OPENAI_API_KEY"); key != "" {
+			c.Token = key
+		}
+	}
+	return nil
+}
+
+func (c *Config) Endpoint() llm.Endpoint {
+	return llm.Endpoint{
+		URL:     c.URL,
+		Token:   c.Token,
+		Headers: c.Headers,
+	}
+}
+
+func (c *Config) NewBackend() (llm.Backend, error) {
+	switch c.Backend {
+	case "ollama":
+		return llm.NewOllama(c.Endpoint()), nil
+
+	case "openai":
+		return llm.NewOpenAI(c.Endpoint()), nil
+
+	default:
+		return nil, fmt.Errorf(
+			"Invalid backend %q. acceptable backends are: ollama, openai",
+			c.Backend,
+		)
+	}
+}
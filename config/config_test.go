@@ -0,0 +1,98 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := Load(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("Loading a missing file failed: %v", err)
+	}
+	if cfg.Backend != Default().Backend || cfg.Model != Default().Model {
+		t.Errorf("expected defaults for a missing file. got=%+v", cfg)
+	}
+
+	path := filepath.Join(dir, "config.json")
+	err = os.WriteFile(path, []byte(`{
+		"url": "http://desktop:11434",
+		"headers": {"X-Proxy": "research"},
+		"options": {"temperature": 0.2, "stop": ["</answer>"]}
+	}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.URL != "http://desktop:11434" {
+		t.Errorf("bad url. got=%q", cfg.URL)
+	}
+	if cfg.Headers["X-Proxy"] != "research" {
+		t.Errorf("bad headers. got=%+v", cfg.Headers)
+	}
+	if o := cfg.Options.String(); o != `temperature=0.2 stop=["</answer>"]` {
+		t.Errorf("bad options. got=%q", o)
+	}
+	if cfg.Model != Default().Model {
+		t.Errorf("unset fields should keep their defaults. got=%q", cfg.Model)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		backend       string
+		env           map[string]string
+		expectedURL   string
+		expectedToken string
+	}{
+		{
+			"ollama",
+			map[string]string{"OLLAMA_HOST": "desktop"},
+			"http://desktop:11434",
+			"",
+		},
+		{
+			"ollama",
+			map[string]string{"OPENAI_API_KEY": "key"},
+			"",
+			"",
+		},
+		{
+			"openai",
+			map[string]string{
+				"OLLAMA_HOST":     "desktop",
+				"OPENAI_BASE_URL": "http://desktop:8000/v1",
+				"OPENAI_API_KEY":  "key",
+			},
+			"http://desktop:8000/v1",
+			"key",
+		},
+	}
+
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.Backend = tt.backend
+
+		err := cfg.ApplyEnv(func(k string) string { return tt.env[k] })
+		if err != nil {
+			t.Errorf("ApplyEnv failed: %v", err)
+			continue
+		}
+		if cfg.URL != tt.expectedURL || cfg.Token != tt.expectedToken {
+			t.Errorf(
+				"bad config. got url=%q token=%q. expected url=%q token=%q",
+				cfg.URL,
+				cfg.Token,
+				tt.expectedURL,
+				tt.expectedToken,
+			)
+		}
+	}
+}
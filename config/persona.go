@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+)
+
+// PersonasDir returns the directory personas are loaded from.
+// This is usually ~/.config/research/personas
+func PersonasDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "personas"), nil
+}
+
+// LoadPersonas reads every .json file in dir as a persona. A persona
+// without a name is named after its file. A missing directory is not an
+// error.
+func LoadPersonas(dir string) ([]llm.Persona, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var personas []llm.Persona
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var p llm.Persona
+		if err := json.Unmarshal(b, &p); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %w", path, err)
+		}
+		if p.Name == "" {
+			p.Name = strings.TrimSuffix(entry.Name(), ".json")
+		}
+		personas = append(personas, p)
+	}
+
+	slices.SortFunc(personas, func(a, b llm.Persona) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return personas, nil
+}
+
+// FindPersona returns the persona called name. Names are compared
+// ignoring case.
+func FindPersona(personas []llm.Persona, name string) (llm.Persona, error) {
+	for _, p := range personas {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+
+	names := make([]string, len(personas))
+	for i, p := range personas {
+		names[i] = p.Name
+	}
+	return llm.Persona{}, fmt.Errorf(
+		"Unknown persona %q. available personas are: %s",
+		name,
+		strings.Join(names, ", "),
+	)
+}
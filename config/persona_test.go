@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPersonas(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"reviewer.json": `{
+			"name": "code reviewer",
+			"system_prompt": "You review code.",
+			"model": "qwen2.5-coder",
+			"options": {"temperature": 0.1}
+		}`,
+		"summarizer.json": `{"system_prompt": "You summarize papers."}`,
+		"notes.txt":       "not a persona",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	personas, err := LoadPersonas(dir)
+	if err != nil {
+		t.Fatalf("Failed to load personas: %v", err)
+	}
+	if len(personas) != 2 {
+		t.Fatalf("expected 2 personas. got=%+v", personas)
+	}
+
+	reviewer, err := FindPersona(personas, "Code Reviewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reviewer.Model != "qwen2.5-coder" || reviewer.Options.String() != "temperature=0.1" {
+		t.Errorf("bad persona. got=%+v", reviewer)
+	}
+
+	summarizer, err := FindPersona(personas, "summarizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summarizer.SystemPrompt != "You summarize papers." {
+		t.Errorf("bad persona. got=%+v", summarizer)
+	}
+
+	if _, err := FindPersona(personas, "literature search"); err == nil {
+		t.Errorf("expected an error for an unknown persona")
+	}
+}
+
+func TestLoadPersonasMissingDir(t *testing.T) {
+	personas, err := LoadPersonas(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || personas != nil {
+		t.Errorf("expected no personas and no error. got=%+v, %v", personas, err)
+	}
+}
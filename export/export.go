@@ -0,0 +1,102 @@
+// Package export renders a saved session into formats that can be pasted
+// into documents or read by other programs.
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+)
+
+type Format string
+
+const (
+	Markdown Format = "markdown"
+	HTML     Format = "html"
+	JSON     Format = "json"
+)
+
+var Formats = []Format{Markdown, HTML, JSON}
+
+// ParseFormat accepts a format's name or its file extension.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "markdown", "md":
+		return Markdown, nil
+	case "html", "htm":
+		return HTML, nil
+	case "json":
+		return JSON, nil
+	}
+	return "", fmt.Errorf(
+		"Unknown export format %q. acceptable formats are: markdown, html, json",
+		name,
+	)
+}
+
+// FormatOf guesses the format from path's extension.
+func FormatOf(path string) (Format, bool) {
+	ext := filepath.Ext(path)
+	if ext == "" {
+		return "", false
+	}
+	f, err := ParseFormat(ext)
+	return f, err == nil
+}
+
+func (f Format) Ext() string {
+	if f == Markdown {
+		return ".md"
+	}
+	return "." + string(f)
+}
+
+func Write(w io.Writer, snap llm.Snapshot, f Format) error {
+	switch f {
+	case Markdown:
+		return WriteMarkdown(w, snap)
+	case HTML:
+		return WriteHTML(w, snap)
+	case JSON:
+		return WriteJSON(w, snap)
+	}
+	return fmt.Errorf("Unknown export format %q", f)
+}
+
+// WriteFile writes snap to a new file at path. It never overwrites a file,
+// the error wraps fs.ErrExist if path already exists.
+func WriteFile(path string, snap llm.Snapshot, f Format) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := Write(file, snap, f); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// typed returns the prompt as the user typed it, with its commands
+func typed(msg llm.Message) string {
+	if msg.Raw != "" {
+		return msg.Raw
+	}
+	return msg.Content
+}
+
+// header is the line under the title
+func header(snap llm.Snapshot) string {
+	parts := []string{snap.Model}
+	if snap.Persona != "" {
+		parts = append(parts, snap.Persona)
+	}
+	if !snap.Created.IsZero() {
+		parts = append(parts, snap.Created.Local().Format("2006-01-02 15:04"))
+	}
+	return strings.Join(parts, " · ")
+}
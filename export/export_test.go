@@ -0,0 +1,148 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+)
+
+func testSnapshot() llm.Snapshot {
+	prompt := llm.NewMessage(llm.RoleUser, "Summarize <notes>")
+	prompt.Raw = "Summarize @file(notes.md)"
+
+	answer := llm.NewMessage(llm.RoleAssistant, "It's about **transformers**.")
+	answer.Interrupted = true
+
+	return llm.Snapshot{
+		Version:      llm.SnapshotVersion,
+		ID:           "20240312-154501-9f2c",
+		Title:        "Reading notes",
+		Model:        "mistral",
+		SystemPrompt: "Be brief.",
+		Messages:     []llm.Message{prompt, answer},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Format
+	}{
+		{"md", Markdown},
+		{"Markdown", Markdown},
+		{".html", HTML},
+		{"json", JSON},
+		{"pdf", ""},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			f, err := ParseFormat(tt.input)
+			if f != tt.expected {
+				t.Errorf("got=%q. expected=%q", f, tt.expected)
+			}
+			if tt.expected == "" && err == nil {
+				t.Errorf("expected an error for %q", tt.input)
+			}
+		})
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteMarkdown(&b, testSnapshot()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"# Reading notes\n",
+		"## System\n\n```text\nBe brief.\n```\n",
+		"## User\n\n```text\nSummarize @file(notes.md)\n```\n",
+		"## Assistant\n\nIt's about **transformers**.\n\n*(interrupted)*\n",
+	}
+	for _, s := range expected {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected the export to contain %q. got=%q", s, b.String())
+		}
+	}
+}
+
+func TestFence(t *testing.T) {
+	got := fence("use ```go blocks")
+	expected := "````text\nuse ```go blocks\n````"
+	if got != expected {
+		t.Errorf("got=%q. expected=%q", got, expected)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteHTML(&b, testSnapshot()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"<title>Reading notes</title>",
+		`<div class="prompt">Summarize @file(notes.md)</div>`,
+		"<p>It's about <strong>transformers</strong>.</p>",
+		`<p class="interrupted">`,
+	}
+	for _, s := range expected {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected the export to contain %q. got=%q", s, b.String())
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteJSON(&b, testSnapshot()); err != nil {
+		t.Fatal(err)
+	}
+
+	var session jsonSession
+	if err := json.Unmarshal(b.Bytes(), &session); err != nil {
+		t.Fatalf("export isn't valid json: %v", err)
+	}
+	if session.Title != "Reading notes" || len(session.Messages) != 2 {
+		t.Fatalf("bad export. got=%+v", session)
+	}
+	prompt := session.Messages[0]
+	if prompt.Typed != "Summarize @file(notes.md)" || prompt.Content != "Summarize <notes>" {
+		t.Errorf("bad prompt. got=%+v", prompt)
+	}
+	if !session.Messages[1].Interrupted {
+		t.Errorf("expected the answer to be interrupted. got=%+v", session.Messages[1])
+	}
+}
+
+func TestWriteFileDoesntOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.md")
+	if err := os.WriteFile(path, []byte("my notes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := WriteFile(path, testSnapshot(), Markdown)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected fs.ErrExist. got=%v", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "my notes" {
+		t.Errorf("the file was overwritten. got=%q", b)
+	}
+
+	other := filepath.Join(t.TempDir(), "export.md")
+	if err := WriteFile(other, testSnapshot(), Markdown); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if b, _ := os.ReadFile(other); !strings.Contains(string(b), "Reading notes") {
+		t.Errorf("expected the export in the new file. got=%q", b)
+	}
+}
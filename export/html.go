@@ -0,0 +1,130 @@
+package export
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// goldmark escapes any html in the answers since it isn't created with
+// html.WithUnsafe
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { max-width: 48rem; margin: 2rem auto; padding: 0 1rem; font-family: system-ui, sans-serif; line-height: 1.5; color: #222; }
+header p { color: #666; }
+section { border-top: 1px solid #ddd; padding: 0.5rem 0; }
+h2 { font-size: 0.9rem; text-transform: uppercase; color: #666; }
+.prompt { white-space: pre-wrap; font-family: ui-monospace, monospace; background: #f5f5f5; padding: 0.75rem; border-radius: 4px; }
+pre { background: #f5f5f5; padding: 0.75rem; overflow-x: auto; border-radius: 4px; }
+.interrupted { color: #a33; font-style: italic; }
+.call { color: #666; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<p>{{.Header}}</p>
+</header>
+{{if .SystemPrompt}}<section>
+<h2>System</h2>
+<div class="prompt">{{.SystemPrompt}}</div>
+</section>
+{{end}}{{range .Messages}}<section class="{{.Class}}">
+<h2>{{.Heading}}</h2>
+{{if .Prompt}}<div class="prompt">{{.Prompt}}</div>{{else}}{{.Answer}}{{end}}
+{{range .Calls}}<p class="call">called <code>{{.}}</code></p>
+{{end}}{{if .Interrupted}}<p class="interrupted">(interrupted)</p>
+{{end}}</section>
+{{end}}</body>
+</html>
+`))
+
+type htmlMessage struct {
+	Class       string
+	Heading     string
+	Prompt      string
+	Answer      template.HTML
+	Interrupted bool
+
+	// tools the model called, see llm.ToolCall.String
+	Calls []string
+}
+
+// WriteHTML writes a standalone page. Prompts are shown as they were typed
+// and answers are rendered from markdown.
+func WriteHTML(w io.Writer, snap llm.Snapshot) error {
+	var messages []htmlMessage
+	for _, msg := range snap.Messages {
+		switch {
+		case msg.Summary:
+			answer, err := renderMarkdown(msg.Content)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, htmlMessage{
+				Class:   "summary",
+				Heading: "Summary of the earlier conversation",
+				Answer:  answer,
+			})
+		case msg.Role == llm.RoleUser:
+			messages = append(messages, htmlMessage{
+				Class:   "user",
+				Heading: "User",
+				Prompt:  typed(msg),
+			})
+		case msg.Role == llm.RoleAssistant:
+			answer, err := renderMarkdown(msg.Content)
+			if err != nil {
+				return err
+			}
+			html := htmlMessage{
+				Class:       "assistant",
+				Heading:     "Assistant",
+				Answer:      answer,
+				Interrupted: msg.Interrupted,
+			}
+			for _, call := range msg.ToolCalls {
+				html.Calls = append(html.Calls, call.String())
+			}
+			messages = append(messages, html)
+		case msg.Role == llm.RoleTool:
+			messages = append(messages, htmlMessage{
+				Class:   "tool",
+				Heading: "Tool: " + msg.ToolName,
+				Prompt:  msg.Content,
+			})
+		}
+	}
+
+	return page.Execute(w, struct {
+		Title        string
+		Header       string
+		SystemPrompt string
+		Messages     []htmlMessage
+	}{
+		Title:        snap.DisplayTitle(),
+		Header:       header(snap),
+		SystemPrompt: snap.SystemPrompt,
+		Messages:     messages,
+	})
+}
+
+func renderMarkdown(s string) (template.HTML, error) {
+	var b bytes.Buffer
+	if err := markdown.Convert([]byte(strings.TrimSpace(s)), &b); err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
@@ -0,0 +1,78 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+)
+
+// jsonSession is separate from llm.Snapshot so the format sessions are
+// saved in can change without breaking programs that read exports.
+type jsonSession struct {
+	ID           string        `json:"id"`
+	Title        string        `json:"title"`
+	Model        string        `json:"model"`
+	Persona      string        `json:"persona,omitempty"`
+	SystemPrompt string        `json:"system_prompt,omitempty"`
+	Options      llm.Options   `json:"options"`
+	Created      time.Time     `json:"created"`
+	Updated      time.Time     `json:"updated"`
+	Messages     []jsonMessage `json:"messages"`
+}
+
+type jsonMessage struct {
+	Role llm.Role `json:"role"`
+
+	// what was sent to the model, with commands expanded
+	Content string `json:"content"`
+
+	// the prompt as it was typed
+	Typed string `json:"typed,omitempty"`
+
+	Time        time.Time  `json:"time,omitzero"`
+	Interrupted bool       `json:"interrupted,omitempty"`
+	Summary     bool       `json:"summary,omitempty"`
+	Stats       *llm.Stats `json:"stats,omitempty"`
+
+	ToolCalls []llm.ToolCall `json:"tool_calls,omitempty"`
+	ToolName  string         `json:"tool_name,omitempty"`
+
+	// the sub-questions and sources of a research report
+	Research *llm.ResearchRun `json:"research,omitempty"`
+}
+
+func WriteJSON(w io.Writer, snap llm.Snapshot) error {
+	session := jsonSession{
+		ID:           snap.ID,
+		Title:        snap.DisplayTitle(),
+		Model:        snap.Model,
+		Persona:      snap.Persona,
+		SystemPrompt: snap.SystemPrompt,
+		Options:      snap.Options,
+		Created:      snap.Created,
+		Updated:      snap.Updated,
+		Messages:     make([]jsonMessage, len(snap.Messages)),
+	}
+	for i, msg := range snap.Messages {
+		session.Messages[i] = jsonMessage{
+			Role:        msg.Role,
+			Content:     msg.Content,
+			Time:        msg.Time,
+			Interrupted: msg.Interrupted,
+			Summary:     msg.Summary,
+			Stats:       msg.Stats,
+			ToolCalls:   msg.ToolCalls,
+			ToolName:    msg.ToolName,
+			Research:    msg.Research,
+		}
+		if msg.Role == llm.RoleUser {
+			session.Messages[i].Typed = typed(msg)
+		}
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(session)
+}
@@ -0,0 +1,57 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+)
+
+// WriteMarkdown writes the conversation with a heading per message. Answers
+// are already markdown so they're written as is. Prompts are put in code
+// blocks so commands like @file(notes.md) show up exactly as they were typed.
+func WriteMarkdown(w io.Writer, snap llm.Snapshot) error {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "# %s\n\n*%s*\n", snap.DisplayTitle(), header(snap))
+	if snap.SystemPrompt != "" {
+		fmt.Fprintf(&b, "\n## System\n\n%s\n", fence(snap.SystemPrompt))
+	}
+
+	for _, msg := range snap.Messages {
+		switch {
+		case msg.Summary:
+			fmt.Fprintf(&b, "\n## Summary of the earlier conversation\n\n%s\n", msg.Content)
+		case msg.Role == llm.RoleUser:
+			fmt.Fprintf(&b, "\n## User\n\n%s\n", fence(typed(msg)))
+		case msg.Role == llm.RoleAssistant:
+			fmt.Fprintf(&b, "\n## Assistant\n\n%s\n", strings.TrimSpace(msg.Content))
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&b, "\n*called %s*\n", call)
+			}
+			if msg.Interrupted {
+				b.WriteString("\n*(interrupted)*\n")
+			}
+		case msg.Role == llm.RoleTool:
+			fmt.Fprintf(&b, "\n## Tool: %s\n\n%s\n", msg.ToolName, fence(msg.Content))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fence puts s in a code block that's longer than any backtick run in s
+func fence(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	ticks := strings.Repeat("`", max(3, longest+1))
+	return ticks + "text\n" + strings.TrimRight(s, "\n") + "\n" + ticks
+}
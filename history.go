@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Hassan-Ibrahim-1/research/export"
+	"github.com/Hassan-Ibrahim-1/research/store"
+)
+
+const historyUsage = `usage: research history <command>
+
+commands:
+  list [query]            lists saved sessions, fuzzy matching query if given
+  show <id>               prints a session's conversation
+  rm <id>...              deletes sessions
+  rename <id> <title>     sets a session's title
+  export [-format f] <id> [file]
+                          writes a session as markdown, html or json to file
+                          or stdout. the format defaults to file's extension
+                          or markdown
+`
+
+// runHistory runs `research history ...` and returns the exit code
+func runHistory(args []string) int {
+	sessions, err := openStore()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal:", err)
+		return 1
+	}
+
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, historyUsage)
+		return 2
+	}
+
+	switch cmd, args := args[0], args[1:]; {
+	case cmd == "list" || cmd == "ls":
+		err = listHistory(os.Stdout, sessions, strings.Join(args, " "))
+	case cmd == "show" && len(args) == 1:
+		err = showHistory(os.Stdout, sessions, args[0])
+	case cmd == "rm" && len(args) > 0:
+		for _, id := range args {
+			if err = sessions.Remove(id); err != nil {
+				break
+			}
+		}
+	case cmd == "rename" && len(args) > 1:
+		err = sessions.Rename(args[0], strings.Join(args[1:], " "))
+	case cmd == "export":
+		err = exportHistory(sessions, args)
+	default:
+		fmt.Fprint(os.Stderr, historyUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal:", err)
+		return 1
+	}
+	return 0
+}
+
+func listHistory(w io.Writer, sessions *store.Store, query string) error {
+	snaps, err := sessions.List()
+	if err != nil {
+		return err
+	}
+	if len(snaps) == 0 {
+		fmt.Fprintln(w, "no sessions in", sessions.Dir())
+		return nil
+	}
+	snaps = store.Filter(snaps, query)
+	if len(snaps) == 0 {
+		fmt.Fprintf(w, "no sessions match %q\n", query)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUPDATED\tMODEL\tMESSAGES\tTITLE")
+	for _, snap := range snaps {
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%d\t%s\n",
+			snap.ID,
+			snap.Updated.Local().Format("2006-01-02 15:04"),
+			snap.Model,
+			len(snap.Messages),
+			snap.DisplayTitle(),
+		)
+	}
+	return tw.Flush()
+}
+
+func showHistory(w io.Writer, sessions *store.Store, id string) error {
+	snap, err := sessions.Load(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s\n%s · %s\n", snap.DisplayTitle(), snap.ID, snap.Model)
+	if snap.SystemPrompt != "" {
+		fmt.Fprintf(w, "system: %s\n", snap.SystemPrompt)
+	}
+	for _, msg := range snap.Messages {
+		content := msg.Content
+		switch {
+		case msg.Summary:
+			fmt.Fprintf(w, "\n(summary of the earlier conversation)\n%s\n", content)
+			continue
+		case msg.Raw != "":
+			content = msg.Raw
+		case msg.Interrupted:
+			content += "\n(interrupted)"
+		}
+		fmt.Fprintf(w, "\n%s: %s\n", msg.Role, content)
+	}
+	return nil
+}
+
+func exportHistory(sessions *store.Store, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	name := fs.String("format", "", "markdown, html or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 && fs.NArg() != 2 {
+		return fmt.Errorf("usage: research history export [-format f] <id> [file]")
+	}
+
+	out := "-"
+	if fs.NArg() == 2 {
+		out = fs.Arg(1)
+	}
+
+	format := export.Markdown
+	if *name != "" {
+		var err error
+		if format, err = export.ParseFormat(*name); err != nil {
+			return err
+		}
+	} else if f, ok := export.FormatOf(out); ok {
+		format = f
+	}
+
+	snap, err := sessions.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if out == "-" {
+		return export.Write(os.Stdout, snap, format)
+	}
+	return export.WriteFile(out, snap, format)
+}
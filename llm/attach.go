@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Hassan-Ibrahim-1/research/command"
+)
+
+// attachOptions change how @file and @link read their sources. They're
+// set with keyword arguments e.g. @file(main.go, lines=10-80)
+type attachOptions struct {
+	// lines=first-last keeps only those lines, counted from 1. either can
+	// be left out e.g. lines=10- or lines=-80. 0 means no limit
+	firstLine, lastLine int
+
+	// mode=text turns html into plain text. mode=raw, the default, keeps
+	// the page as it was sent
+	text bool
+
+	// max=20kb cuts every source off after that many bytes. 0 means no limit
+	max int
+}
+
+// checkKeywords returns an error if cmd has a keyword argument that isn't
+// one of allowed
+func checkKeywords(cmd command.Command, allowed ...string) error {
+	for name := range cmd.Keywords {
+		if slices.Contains(allowed, name) {
+			continue
+		}
+		if len(allowed) == 0 {
+			return fmt.Errorf("@%s doesn't take keyword arguments", cmd.Name)
+		}
+		return fmt.Errorf(
+			"Unknown argument %q for @%s. acceptable arguments are: %s",
+			name,
+			cmd.Name,
+			strings.Join(allowed, ", "),
+		)
+	}
+	return nil
+}
+
+// parseAttachOptions reads cmd's keyword arguments. which ones cmd may
+// take is checked by its PromptCommand
+func parseAttachOptions(cmd command.Command) (attachOptions, error) {
+	var opts attachOptions
+	for name, value := range cmd.Keywords {
+		var err error
+		switch name {
+		case "lines":
+			opts.firstLine, opts.lastLine, err = parseLineRange(value)
+		case "mode":
+			switch value {
+			case "text":
+				opts.text = true
+			case "raw":
+			default:
+				err = fmt.Errorf("expected text or raw got %q", value)
+			}
+		case "max":
+			opts.max, err = parseSize(value)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("Invalid %s for @%s: %w", name, cmd.Name, err)
+		}
+	}
+	return opts, nil
+}
+
+// parseLineRange parses 10-80, 10-, -80 or 10
+func parseLineRange(s string) (first, last int, err error) {
+	from, to, isRange := strings.Cut(s, "-")
+	if !isRange {
+		to = from
+	}
+	if from != "" {
+		if first, err = strconv.Atoi(strings.TrimSpace(from)); err != nil || first < 1 {
+			return 0, 0, fmt.Errorf("expected a range of lines like 10-80 got %q", s)
+		}
+	}
+	if to != "" {
+		if last, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || last < 1 {
+			return 0, 0, fmt.Errorf("expected a range of lines like 10-80 got %q", s)
+		}
+	}
+	if first == 0 && last == 0 {
+		return 0, 0, fmt.Errorf("expected a range of lines like 10-80 got %q", s)
+	}
+	if last > 0 && first > last {
+		return 0, 0, fmt.Errorf("line %d comes after line %d", first, last)
+	}
+	return first, last, nil
+}
+
+// parseSize parses a number of bytes with an optional b, kb or mb suffix
+// e.g. 20kb
+func parseSize(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	unit := 1
+	for _, suffix := range []struct {
+		name string
+		size int
+	}{{"kb", 1024}, {"mb", 1024 * 1024}, {"b", 1}} {
+		if strings.HasSuffix(s, suffix.name) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, suffix.name))
+			unit = suffix.size
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("expected a size like 20kb got %q", s)
+	}
+	return n * unit, nil
+}
+
+// apply returns the part of content the options keep
+func (opts attachOptions) apply(content []byte) []byte {
+	if opts.text {
+		content = []byte(htmlToText(string(content)))
+	}
+
+	if opts.firstLine > 0 || opts.lastLine > 0 {
+		lines := strings.SplitAfter(string(content), "\n")
+		first := min(max(opts.firstLine, 1), len(lines)+1) - 1
+		last := len(lines)
+		if opts.lastLine > 0 {
+			last = min(opts.lastLine, len(lines))
+		}
+		content = []byte(strings.TrimSuffix(strings.Join(lines[first:last], ""), "\n"))
+	}
+
+	if opts.max > 0 && len(content) > opts.max {
+		n := runeCut(content, opts.max)
+		content = append(content[:n:n], "\n(the rest was cut off)"...)
+	}
+	return content
+}
+
+var (
+	invisibleElements = regexp.MustCompile(`(?is)<(script|style|head|noscript)\b.*?</(script|style|head|noscript)>`)
+	comments          = regexp.MustCompile(`(?s)<!--.*?-->`)
+	blockTags         = regexp.MustCompile(`(?i)</?(p|div|br|li|tr|h[1-6]|section|article|pre|blockquote)\b[^>]*>`)
+	tags              = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLines        = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// htmlToText keeps the text of a page without its markup. it's not a real
+// html parser but it's good enough to save the model from reading the tags
+func htmlToText(s string) string {
+	s = invisibleElements.ReplaceAllString(s, "")
+	s = comments.ReplaceAllString(s, "")
+	s = blockTags.ReplaceAllString(s, "\n")
+	s = tags.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	s = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLines.ReplaceAllString(s, "\n\n"))
+}
@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hassan-Ibrahim-1/research/command"
+)
+
+func TestParseAttachOptions(t *testing.T) {
+	tests := []struct {
+		keywords map[string]string
+		expected attachOptions
+		err      string
+	}{
+		{nil, attachOptions{}, ""},
+		{map[string]string{"lines": "10-80"}, attachOptions{firstLine: 10, lastLine: 80}, ""},
+		{map[string]string{"lines": "10-"}, attachOptions{firstLine: 10}, ""},
+		{map[string]string{"lines": "-5", "max": "20kb"}, attachOptions{lastLine: 5, max: 20 * 1024}, ""},
+		{map[string]string{"lines": "7"}, attachOptions{firstLine: 7, lastLine: 7}, ""},
+		{map[string]string{"max": "100"}, attachOptions{max: 100}, ""},
+		{map[string]string{"lines": "80-10"}, attachOptions{}, "Invalid lines"},
+		{map[string]string{"lines": "a-b"}, attachOptions{}, "Invalid lines"},
+		{map[string]string{"max": "lots"}, attachOptions{}, "Invalid max"},
+		{map[string]string{"mode": "text"}, attachOptions{text: true}, ""},
+		{map[string]string{"mode": "pdf"}, attachOptions{}, "Invalid mode"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			cmd := command.Command{Name: "file", Keywords: tt.keywords}
+			opts, err := parseAttachOptions(cmd)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error with %q. got=%v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAttachOptions failed: %v", err)
+			}
+			if opts != tt.expected {
+				t.Errorf("got=%+v. expected=%+v", opts, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAttachOptions(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lines.txt")
+	os.WriteFile(file, []byte("one\ntwo\nthree\nfour\n"), 0o644)
+	accents := filepath.Join(t.TempDir(), "accents.txt")
+	os.WriteFile(accents, []byte("héllo"), 0o644)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `<html><head><title>x</title><style>p {}</style></head>
+<body><h1>Title</h1><p>Fish &amp; chips</p><script>alert(1)</script></body></html>`)
+		},
+	))
+	defer server.Close()
+
+	tag := func(kind, attr, name, content string) string {
+		return fmt.Sprintf("<%s id=\"1\" %s=%q>\n%s\n</%s>\n", kind, attr, name, content, kind)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{fmt.Sprintf("@file(%s, lines=2-3)", file), tag("file", "name", file, "two\nthree")},
+		{fmt.Sprintf("@file(%s, lines=3-)", file), tag("file", "name", file, "three\nfour")},
+		{fmt.Sprintf("@file(%s, max=5b)", file), tag("file", "name", file, "one\nt\n(the rest was cut off)")},
+		{fmt.Sprintf("@file(%s, max=2b)", accents), tag("file", "name", accents, "h\n(the rest was cut off)")},
+		{fmt.Sprintf("@link(%s, mode=text)", server.URL), tag("link", "url", server.URL, "Title\n\nFish & chips")},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			s := NewSession("test", &fakeBackend{})
+			got, err := s.executePromptCommands(context.Background(), []byte(tt.input))
+			if err != nil {
+				t.Fatalf("executePromptCommands failed: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("got=%q. expected=%q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAttachOptionsInvalid(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"@file(a.md, mode=text)", `Unknown argument "mode" for @file. acceptable arguments are: lines, max`},
+		{"@link(https://x.com, lines=1-2)", `Unknown argument "lines" for @link. acceptable arguments are: mode, max`},
+		{"@link(https://x.com, mode=pdf)", `Invalid mode for @link: expected text or raw got "pdf"`},
+		{"@text(a, b=c)", "@text doesn't take keyword arguments"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			s := NewSession("test", &fakeBackend{})
+			_, err := s.executePromptCommands(context.Background(), []byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got=%v. expected=%q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAttachLinkCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		},
+	))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	s := NewSession("test", &fakeBackend{})
+	_, err := s.SendPrompt(ctx, fmt.Sprintf("summarize @link(%s)", server.URL))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the fetch to be cancelled. got=%v", err)
+	}
+	if len(s.Messages()) != 0 {
+		t.Errorf("a cancelled prompt shouldn't be added. got=%+v", s.Messages())
+	}
+}
@@ -0,0 +1,49 @@
+package llm
+
+import (
+	"context"
+	"errors"
+)
+
+// errIncompleteResponse is sent when a stream ends without the server
+// saying the answer is done
+var errIncompleteResponse = errors.New("the response ended before the answer was complete")
+
+// Backend is a model server that a Session sends its conversation to.
+type Backend interface {
+	// Chat sends req to the server and streams back the assistant's answer.
+	// The returned channel is closed after a Done or Error event or when
+	// ctx is cancelled.
+	Chat(ctx context.Context, req ChatRequest) (<-chan Event, error)
+
+	// Ping returns an error if the server can't be reached.
+	Ping() error
+}
+
+// chatMessage is how a Message is sent over the wire. Message carries
+// bookkeeping that servers don't need to see.
+type chatMessage struct {
+	Role      Role           `json:"role"`
+	Content   string         `json:"content"`
+	ToolCalls []chatToolCall `json:"tool_calls,omitempty"`
+	ToolName  string         `json:"tool_name,omitempty"`
+}
+
+type chatToolCall struct {
+	Function ToolCall `json:"function"`
+}
+
+func toChatMessages(messages []Message) []chatMessage {
+	ret := make([]chatMessage, len(messages))
+	for i, msg := range messages {
+		ret[i] = chatMessage{
+			Role:     msg.Role,
+			Content:  msg.Content,
+			ToolName: msg.ToolName,
+		}
+		for _, call := range msg.ToolCalls {
+			ret[i].ToolCalls = append(ret[i].ToolCalls, chatToolCall{call})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,174 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOllamaChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/chat" {
+				t.Errorf("unexpected path %q", r.URL.Path)
+			}
+
+			var req ollamaChatRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("bad request body: %v", err)
+			}
+			if req.Model != "mistral" || !req.Stream {
+				t.Errorf("unexpected request %+v", req)
+			}
+
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Hello"},"done":false}`)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":", World"},"done":false}`)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"eval_count":4,"eval_duration":2000000000,"prompt_eval_count":12,"load_duration":500}`)
+		},
+	))
+	defer server.Close()
+
+	stats := testBackendChat(
+		t,
+		NewOllama(Endpoint{URL: server.URL}),
+		"Hello, World",
+	)
+	if stats.EvalCount != 4 || stats.PromptEvalCount != 12 || stats.LoadDuration != 500 {
+		t.Errorf("bad stats. got=%+v", stats)
+	}
+	if tps := stats.TokensPerSecond(); tps != 2 {
+		t.Errorf("bad tokens per second. got=%f. expected=2", tps)
+	}
+}
+
+func TestOpenAIChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/chat/completions" {
+				t.Errorf("unexpected path %q", r.URL.Path)
+			}
+			if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+				t.Errorf("unexpected authorization header %q", auth)
+			}
+
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\", World\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":4}}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		},
+	))
+	defer server.Close()
+
+	stats := testBackendChat(
+		t,
+		NewOpenAI(Endpoint{URL: server.URL + "/v1", Token: "key"}),
+		"Hello, World",
+	)
+	if stats.EvalCount != 4 || stats.PromptEvalCount != 12 {
+		t.Errorf("bad stats. got=%+v", stats)
+	}
+}
+
+func TestOllamaChatErrors(t *testing.T) {
+	tests := []struct {
+		body string
+	}{
+		// connection dropped before done
+		{`{"message":{"role":"assistant","content":"Hello"},"done":false}` + "\n"},
+		{`{"message":{"role":"assistant","content":"Hello"},"done":false}` + "\n{not json\n"},
+		{`{"error":"model ran out of memory"}` + "\n"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, tt.body)
+				},
+			))
+			defer server.Close()
+
+			events := readEvents(t, NewOllama(Endpoint{URL: server.URL}))
+			if len(events) == 0 {
+				t.Fatalf("expected an Error event")
+			}
+			if _, ok := events[len(events)-1].(Error); !ok {
+				t.Errorf(
+					"expected the stream to end with an Error. got=%+v",
+					events,
+				)
+			}
+		})
+	}
+}
+
+func TestOllamaChatThinking(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"message":{"role":"assistant","thinking":"hmm"},"done":false}`)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Hi"},"done":false}`)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true}`)
+		},
+	))
+	defer server.Close()
+
+	events := readEvents(t, NewOllama(Endpoint{URL: server.URL}))
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events. got=%+v", events)
+	}
+	if ev, ok := events[0].(Thinking); !ok || ev.Content != "hmm" {
+		t.Errorf("expected a Thinking event. got=%+v", events[0])
+	}
+	if ev, ok := events[1].(Token); !ok || ev.Content != "Hi" {
+		t.Errorf("expected a Token event. got=%+v", events[1])
+	}
+	if _, ok := events[2].(Done); !ok {
+		t.Errorf("expected a Done event. got=%+v", events[2])
+	}
+}
+
+func readEvents(t *testing.T, backend Backend) []Event {
+	ch, err := backend.Chat(context.Background(), ChatRequest{
+		Model: "mistral",
+		Messages: []Message{
+			NewMessage(RoleUser, "Hey"),
+			NewMessage(RoleAssistant, "Hi"),
+			NewMessage(RoleUser, "How are you?"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	var events []Event
+	for ev := range ch {
+		events = append(events, ev)
+	}
+	return events
+}
+
+// returns the stats of the Done event
+func testBackendChat(t *testing.T, backend Backend, expected string) Stats {
+	events := readEvents(t, backend)
+
+	var b strings.Builder
+	for _, ev := range events {
+		if token, ok := ev.(Token); ok {
+			b.WriteString(token.Content)
+		}
+	}
+
+	if b.String() != expected {
+		t.Errorf("bad response. got=%q. expected=%q", b.String(), expected)
+	}
+	done, ok := events[len(events)-1].(Done)
+	if !ok {
+		t.Errorf("expected the stream to end with Done. got=%+v", events)
+	}
+	return done.Stats
+}
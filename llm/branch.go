@@ -0,0 +1,166 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Node is a message in the tree of a session's branches. Its children are
+// the alternatives for the message that follows it, e.g. a prompt's
+// regenerated answers or the edited versions of the next prompt.
+type Node struct {
+	Message  Message `json:"message"`
+	Children []*Node `json:"children,omitempty"`
+
+	// index of the child on the current branch
+	Active int `json:"active,omitempty"`
+}
+
+func (n *Node) clone() *Node {
+	c := &Node{
+		Message:  n.Message,
+		Children: make([]*Node, len(n.Children)),
+		Active:   n.Active,
+	}
+	for i, child := range n.Children {
+		c.Children[i] = child.clone()
+	}
+	return c
+}
+
+// followActive returns the nodes below n on its current branch
+func followActive(n *Node) []*Node {
+	var path []*Node
+	for len(n.Children) > 0 {
+		n.Active = min(max(0, n.Active), len(n.Children)-1)
+		n = n.Children[n.Active]
+		path = append(path, n)
+	}
+	return path
+}
+
+// history returns the messages on the current branch. s.mu must be held
+func (s *Session) history() []Message {
+	messages := make([]Message, len(s.path))
+	for i, n := range s.path {
+		messages[i] = n.Message
+	}
+	return messages
+}
+
+// setHistory replaces the tree with a single branch. s.mu must be held
+func (s *Session) setHistory(messages []Message) {
+	s.root = Node{}
+	s.path = nil
+	s.appendToPath(messages...)
+}
+
+// appendToPath adds msgs after the last message of the current branch.
+// s.mu must be held
+func (s *Session) appendToPath(msgs ...Message) {
+	for _, msg := range msgs {
+		parent := s.parent(len(s.path))
+		parent.Children = append(parent.Children, &Node{Message: msg})
+		parent.Active = len(parent.Children) - 1
+		s.path = append(s.path, parent.Children[parent.Active])
+	}
+}
+
+// parent returns the node before the message at index on the current
+// branch. s.mu must be held
+func (s *Session) parent(index int) *Node {
+	if index == 0 {
+		return &s.root
+	}
+	return s.path[index-1]
+}
+
+// EditPrompt sends prompt in place of the user message at index in
+// Messages. The old prompt and everything after it are kept as another
+// branch.
+func (s *Session) EditPrompt(
+	ctx context.Context,
+	index int,
+	prompt string,
+) (<-chan Event, error) {
+	s.mu.Lock()
+	if index < 0 || index >= len(s.path) || s.path[index].Message.Role != RoleUser {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("Message %d isn't a prompt", index)
+	}
+	path := s.path
+	s.path = slices.Clone(s.path[:index])
+	s.mu.Unlock()
+
+	ch, err := s.SendPrompt(ctx, prompt)
+	if err != nil {
+		s.mu.Lock()
+		s.path = path
+		s.mu.Unlock()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// Regenerate asks for another answer in place of the assistant message at
+// index in Messages. The old answer and everything after it are kept as
+// another branch.
+func (s *Session) Regenerate(ctx context.Context, index int) (<-chan Event, error) {
+	s.mu.Lock()
+	// an answer follows either its prompt or the outputs of the tools it
+	// called
+	if index < 1 || index >= len(s.path) ||
+		s.path[index].Message.Role != RoleAssistant ||
+		s.path[index-1].Message.Role == RoleAssistant {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("Message %d isn't an answer to a prompt", index)
+	}
+	path := s.path
+	s.path = slices.Clone(s.path[:index])
+	messages := s.requestMessages()
+	s.mu.Unlock()
+
+	ch, err := s.respond(ctx, messages, nil)
+	if err != nil {
+		s.mu.Lock()
+		s.path = path
+		s.mu.Unlock()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// Branches returns the position of the message at index in Messages among
+// its alternatives, starting at 1, and how many alternatives there are.
+func (s *Session) Branches(index int) (current int, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if index < 0 || index >= len(s.path) {
+		return 0, 0
+	}
+	parent := s.parent(index)
+	return parent.Active + 1, len(parent.Children)
+}
+
+// SwitchBranch replaces the message at index in Messages with the
+// alternative delta positions away and continues with that alternative's
+// last used branch. It returns false if there is no such alternative.
+func (s *Session) SwitchBranch(index int, delta int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if index < 0 || index >= len(s.path) {
+		return false
+	}
+	parent := s.parent(index)
+	next := parent.Active + delta
+	if next < 0 || next >= len(parent.Children) {
+		return false
+	}
+
+	parent.Active = next
+	s.path = append(s.path[:index:index], followActive(parent)...)
+	return true
+}
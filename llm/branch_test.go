@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// countingBackend answers every prompt with "<prompt> #<n>" where n counts
+// the requests
+func countingBackend() *fakeBackend {
+	return &fakeBackend{reply: func(n int, req ChatRequest) fakeReply {
+		prompt := req.Messages[len(req.Messages)-1].Content
+		return fakeReply{chunks: []string{fmt.Sprintf("%s #%d", prompt, n+1)}}
+	}}
+}
+
+func readAll(t *testing.T, ch <-chan Event, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	for range ch {
+	}
+}
+
+func contents(messages []Message) []string {
+	var c []string
+	for _, msg := range messages {
+		c = append(c, msg.Content)
+	}
+	return c
+}
+
+func TestBranches(t *testing.T) {
+	s := NewSession("test", countingBackend())
+	ctx := context.Background()
+
+	ch, err := s.SendPrompt(ctx, "a")
+	readAll(t, ch, err)
+	ch, err = s.SendPrompt(ctx, "b")
+	readAll(t, ch, err)
+
+	ch, err = s.Regenerate(ctx, 3)
+	readAll(t, ch, err)
+	ch, err = s.EditPrompt(ctx, 0, "c")
+	readAll(t, ch, err)
+
+	tests := []struct {
+		index    int
+		delta    int
+		ok       bool
+		expected []string
+	}{
+		// the edited prompt is the newest branch
+		{0, 0, true, []string{"c", "c #4"}},
+		{0, -1, true, []string{"a", "a #1", "b", "b #3"}},
+		{3, -1, true, []string{"a", "a #1", "b", "b #2"}},
+		{3, -1, false, []string{"a", "a #1", "b", "b #2"}},
+		{0, 1, true, []string{"c", "c #4"}},
+		// the first branch still continues with the answer picked above
+		{0, -1, true, []string{"a", "a #1", "b", "b #2"}},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			if ok := s.SwitchBranch(tt.index, tt.delta); ok != tt.ok {
+				t.Errorf("bad result. got=%v. expected=%v", ok, tt.ok)
+			}
+			if got := contents(s.Messages()); !slices.Equal(got, tt.expected) {
+				t.Errorf("got=%q. expected=%q", got, tt.expected)
+			}
+		})
+	}
+
+	if current, count := s.Branches(3); current != 1 || count != 2 {
+		t.Errorf("bad branches. got=%d/%d. expected=1/2", current, count)
+	}
+
+	restored := NewSession("test", nil)
+	restored.Restore(s.Snapshot())
+	if !restored.SwitchBranch(0, 1) {
+		t.Fatalf("expected the restored session to keep its branches")
+	}
+	if got := contents(restored.Messages()); !slices.Equal(got, []string{"c", "c #4"}) {
+		t.Errorf("got=%q", got)
+	}
+}
+
+func TestBranchErrors(t *testing.T) {
+	s := NewSession("test", countingBackend())
+	ch, err := s.SendPrompt(context.Background(), "a")
+	readAll(t, ch, err)
+
+	if _, err := s.EditPrompt(context.Background(), 1, "b"); err == nil {
+		t.Errorf("expected an error for editing an answer")
+	}
+	if _, err := s.Regenerate(context.Background(), 0); err == nil {
+		t.Errorf("expected an error for regenerating a prompt")
+	}
+	if _, err := s.EditPrompt(context.Background(), 0, "@unknown(x)"); err == nil {
+		t.Errorf("expected an error for an invalid command")
+	}
+	if got := contents(s.Messages()); !slices.Equal(got, []string{"a", "a #1"}) {
+		t.Errorf("a failed edit should keep the history. got=%q", got)
+	}
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	s := NewSession("test", countingBackend())
+	ctx := context.Background()
+	ch, err := s.SendPrompt(ctx, "a")
+	readAll(t, ch, err)
+	ch, err = s.Regenerate(ctx, 1)
+	readAll(t, ch, err)
+	s.SwitchBranch(1, -1)
+
+	b, err := json.Marshal(s.Snapshot())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(b), `"messages"`) {
+		t.Errorf("the current branch shouldn't be saved next to the tree. got=%s", b)
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if got := contents(snap.Messages); !slices.Equal(got, []string{"a", "a #1"}) {
+		t.Errorf("expected the active branch. got=%q", got)
+	}
+
+	// version 1 files have both and the tree wins
+	v1 := `{"version":1,"id":"x","messages":[{"role":"user","content":"stale"}],
+"tree":{"message":{"role":"","content":""},"children":[{"message":{"role":"user","content":"a"}}]}}`
+	if err := json.Unmarshal([]byte(v1), &snap); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if got := contents(snap.Messages); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("expected the tree's branch. got=%q", got)
+	}
+}
@@ -0,0 +1,166 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// used for the budget when neither a budget nor num_ctx is set.
+	// this is ollama's default context length
+	defaultContextLength = 4096
+
+	// messages at the end of the history that are never summarized so the
+	// model still sees the last couple of turns word for word
+	keepRecentMessages = 4
+
+	// tokens added for every message by the chat template
+	messageOverhead = 4
+
+	summaryPrompt = `You condense chat histories. Summarize the conversation you are given so that it can replace the conversation in the chat's history.
+Keep every fact, decision, name, number, file name and link that was mentioned, along with any questions that are still open.
+Be concise and write in the third person, e.g. "The user asked ...".`
+
+	summaryPrefix = "Summary of the earlier conversation:\n"
+)
+
+// EstimateTokens approximates how many tokens s is. Most tokenizers average
+// about four characters per token for English text. It's only used to
+// decide when to compact the history so it doesn't need to be exact.
+func EstimateTokens(s string) int {
+	return (utf8.RuneCountInString(s) + 3) / 4
+}
+
+func estimateMessages(messages []Message) int {
+	n := 0
+	for _, msg := range messages {
+		n += EstimateTokens(msg.Content) + messageOverhead
+	}
+	return n
+}
+
+// TokenBudget returns how many tokens the system prompt and history may
+// take up before older messages are summarized. If no budget was set it is
+// three quarters of num_ctx so there's still room for the answer.
+func (s *Session) TokenBudget() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokenBudget > 0 {
+		return s.tokenBudget
+	}
+	contextLength := defaultContextLength
+	if s.options.NumCtx != nil {
+		contextLength = *s.options.NumCtx
+	}
+	return contextLength * 3 / 4
+}
+
+// SetTokenBudget sets the budget returned by TokenBudget. 0 goes back to
+// deriving it from num_ctx.
+func (s *Session) SetTokenBudget(budget int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenBudget = max(0, budget)
+}
+
+// ContextUsage returns the estimated number of tokens the system prompt and
+// history take up.
+func (s *Session) ContextUsage() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return EstimateTokens(s.systemPrompt) + estimateMessages(s.history())
+}
+
+// Condensed reports whether older messages have been replaced by a summary.
+func (s *Session) Condensed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.path) > 0 && s.path[0].Message.Summary
+}
+
+// compact summarizes the oldest messages if the history is over the token
+// budget. It returns false if nothing had to be done.
+func (s *Session) compact(ctx context.Context) (Compacted, bool) {
+	if s.ContextUsage() <= s.TokenBudget() {
+		return Compacted{}, false
+	}
+
+	s.mu.Lock()
+	n := len(s.path) - keepRecentMessages
+	old := s.history()[:max(0, n)]
+	s.mu.Unlock()
+
+	// a single summary is as condensed as the history is going to get
+	if len(old) == 0 || (len(old) == 1 && old[0].Summary) {
+		return Compacted{}, false
+	}
+
+	summary, err := s.summarize(ctx, old)
+	if err != nil {
+		return Compacted{Err: fmt.Errorf("Failed to condense the history: %w", err)}, true
+	}
+
+	msg := NewMessage(RoleSystem, summaryPrefix+summary)
+	msg.Summary = true
+
+	// branches that split off before the kept messages are dropped since
+	// they can't continue from the summary
+	s.mu.Lock()
+	summaryNode := &Node{Message: msg, Children: []*Node{s.path[len(old)]}}
+	s.root = Node{Children: []*Node{summaryNode}}
+	s.path = append([]*Node{summaryNode}, s.path[len(old):]...)
+	s.mu.Unlock()
+
+	return Compacted{Summarized: len(old)}, true
+}
+
+// summarize asks the model to condense messages
+func (s *Session) summarize(ctx context.Context, messages []Message) (string, error) {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleUser:
+			transcript.WriteString("User: ")
+		case RoleAssistant:
+			transcript.WriteString("Assistant: ")
+		}
+		transcript.WriteString(msg.Content + "\n\n")
+	}
+
+	return s.complete(ctx, []Message{
+		NewMessage(RoleSystem, summaryPrompt),
+		NewMessage(RoleUser, transcript.String()),
+	})
+}
+
+// complete returns the model's whole answer to messages without adding
+// anything to the history
+func (s *Session) complete(ctx context.Context, messages []Message) (string, error) {
+	s.mu.Lock()
+	request := ChatRequest{Model: s.model, Messages: messages, Options: s.options}
+	s.mu.Unlock()
+
+	response, err := s.backend.Chat(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	var answer strings.Builder
+	for ev := range response {
+		switch ev := ev.(type) {
+		case Token:
+			answer.WriteString(ev.Content)
+		case Error:
+			return "", ev.Err
+		case Done:
+			return strings.TrimSpace(answer.String()), nil
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return "", errIncompleteResponse
+}
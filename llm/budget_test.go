@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// summarizingBackend answers summary requests with "condensed" and
+// everything else with answer
+func summarizingBackend(answer string) *fakeBackend {
+	return &fakeBackend{reply: func(n int, req ChatRequest) fakeReply {
+		if req.Messages[0].Content == summaryPrompt {
+			return fakeReply{chunks: []string{"condensed"}}
+		}
+		return fakeReply{chunks: []string{answer}}
+	}}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"four", 1},
+		{"hello world!", 3},
+		{"héllo", 2},
+	}
+
+	for _, tt := range tests {
+		if n := EstimateTokens(tt.input); n != tt.expected {
+			t.Errorf("EstimateTokens(%q). got=%d. expected=%d", tt.input, n, tt.expected)
+		}
+	}
+}
+
+func TestTokenBudget(t *testing.T) {
+	s := NewSession("test", nil)
+	if b := s.TokenBudget(); b != defaultContextLength*3/4 {
+		t.Errorf("bad default budget. got=%d", b)
+	}
+
+	_ = s.options.Set("num_ctx", "8192")
+	if b := s.TokenBudget(); b != 6144 {
+		t.Errorf("budget should follow num_ctx. got=%d", b)
+	}
+
+	s.SetTokenBudget(1000)
+	if b := s.TokenBudget(); b != 1000 {
+		t.Errorf("an explicit budget should win. got=%d", b)
+	}
+}
+
+func TestSendPromptCompacts(t *testing.T) {
+	s := NewSession("test", summarizingBackend(strings.Repeat("word ", 20)))
+	s.SetTokenBudget(100)
+
+	var compactions []Compacted
+	for range 4 {
+		ch, err := s.SendPrompt(context.Background(), strings.Repeat("question ", 10))
+		if err != nil {
+			t.Fatalf("SendPrompt failed: %v", err)
+		}
+		for ev := range ch {
+			if c, ok := ev.(Compacted); ok {
+				compactions = append(compactions, c)
+			}
+		}
+	}
+
+	if len(compactions) == 0 {
+		t.Fatalf("expected the history to be compacted")
+	}
+	for _, c := range compactions {
+		if c.Err != nil {
+			t.Errorf("compaction failed: %v", c.Err)
+		}
+	}
+
+	messages := s.Messages()
+	if !messages[0].Summary || messages[0].Content != summaryPrefix+"condensed" {
+		t.Errorf("expected the history to start with a summary. got=%+v", messages[0])
+	}
+	if len(messages) != keepRecentMessages+1 {
+		t.Errorf(
+			"expected the summary and the %d most recent messages. got=%d",
+			keepRecentMessages,
+			len(messages),
+		)
+	}
+}
@@ -2,87 +2,164 @@ package llm
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/Hassan-Ibrahim-1/research/command"
 )
 
-func (s *Session) attachFile(
-	cmd command.Command,
-	prompt []byte,
-) ([]byte, error) {
-	if len(cmd.Arguments) == 0 {
-		return prompt, nil
+// how long fetching a link may take, including reading the page
+const fetchTimeout = 30 * time.Second
+
+func builtinCommands() []PromptCommand {
+	return []PromptCommand{
+		{
+			Name:     "file",
+			Aliases:  []string{"attach-file"},
+			Help:     "attaches files. lines=10-80 keeps only those lines, max=20kb cuts them off",
+			Arg:      "file",
+			MinArgs:  1,
+			Keywords: []string{"lines", "max"},
+			Check:    checkAttachOptions,
+			Run:      attachFile,
+		},
+		{
+			Name:     "link",
+			Aliases:  []string{"attach-link"},
+			Help:     "attaches the pages at links. mode=text strips the html, max=20kb cuts them off",
+			Arg:      "link",
+			MinArgs:  1,
+			Keywords: []string{"mode", "max"},
+			Check:    checkAttachOptions,
+			Run:      attachLink,
+		},
+		{
+			// mostly for testing purposes
+			Name: "text",
+			Help: "is replaced with its arguments",
+			Arg:  "text",
+			Run: func(ctx context.Context, s *Session, cmd command.Command) ([]byte, error) {
+				return []byte(strings.Join(cmd.Arguments, ", ")), nil
+			},
+		},
 	}
+}
 
-	var fileContents bytes.Buffer
-	for _, file := range cmd.Arguments {
-		b, err := os.ReadFile(file)
-		if err != nil {
-			return nil, err
-		}
-
-		_, err = fileContents.WriteString(fmt.Sprintf("<file name=%q>\n", file))
-		if err != nil {
-			return nil, err
-		}
-
-		_, err = fileContents.Write(b)
-		if err != nil {
-			return nil, err
-		}
+// attachFile returns what cmd is replaced with in the prompt
+func attachFile(ctx context.Context, s *Session, cmd command.Command) ([]byte, error) {
+	opts, err := parseAttachOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return s.attachSources(ctx, SourceFile, cmd.Arguments, opts)
+}
 
-		_, err = fileContents.WriteString("\n</file>\n")
-		if err != nil {
-			return nil, err
-		}
+// attachLink returns what cmd is replaced with in the prompt
+func attachLink(ctx context.Context, s *Session, cmd command.Command) ([]byte, error) {
+	opts, err := parseAttachOptions(cmd)
+	if err != nil {
+		return nil, err
 	}
+	return s.attachSources(ctx, SourceLink, cmd.Arguments, opts)
+}
 
-	embedded := embed(fileContents.Bytes(), cmd.Loc, prompt)
-	return embedded, nil
+func checkAttachOptions(cmd command.Command) error {
+	_, err := parseAttachOptions(cmd)
+	return err
 }
 
-func (s *Session) attachLink(
-	cmd command.Command,
-	prompt []byte,
+// attachSources reads every source and wraps each one in a tag with its
+// id, see Session.Sources and attachSource. sources only get an id once all
+// of them could be read
+func (s *Session) attachSources(
+	ctx context.Context,
+	kind SourceKind,
+	names []string,
+	opts attachOptions,
 ) ([]byte, error) {
-	if len(cmd.Arguments) == 0 {
-		return prompt, nil
-	}
-
-	var urlContents bytes.Buffer
-	for _, url := range cmd.Arguments {
-		resp, err := http.Get(url)
+	contents := make([][]byte, len(names))
+	for i, name := range names {
+		content, err := fetchSource(ctx, Source{Kind: kind, Name: name})
 		if err != nil {
 			return nil, err
 		}
+		contents[i] = opts.apply(content)
+	}
 
-		b, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
+	var b bytes.Buffer
+	for i, name := range names {
+		writeSource(&b, s.attachSource(kind, name), contents[i])
+	}
+	return b.Bytes(), nil
+}
 
-		_, err = urlContents.WriteString(fmt.Sprintf("<link url=%q>\n", url))
+// readFiles returns the contents of files, each one wrapped in a <file> tag
+func readFiles(files []string) ([]byte, error) {
+	var fileContents bytes.Buffer
+	for _, file := range files {
+		b, err := os.ReadFile(file)
 		if err != nil {
 			return nil, err
 		}
+		writeSource(&fileContents, Source{Kind: SourceFile, Name: file}, b)
+	}
+	return fileContents.Bytes(), nil
+}
 
-		_, err = urlContents.Write(b)
+// fetchLinks returns the bodies of urls, each one wrapped in a <link> tag
+func fetchLinks(ctx context.Context, urls []string) ([]byte, error) {
+	var urlContents bytes.Buffer
+	for _, url := range urls {
+		b, err := fetchLink(ctx, url)
 		if err != nil {
 			return nil, err
 		}
+		writeSource(&urlContents, Source{Kind: SourceLink, Name: url}, b)
+	}
+	return urlContents.Bytes(), nil
+}
 
-		_, err = urlContents.WriteString(fmt.Sprintf("\n</link>\n"))
-		if err != nil {
-			return nil, err
-		}
+func fetchSource(ctx context.Context, source Source) ([]byte, error) {
+	if source.Kind == SourceLink {
+		return fetchLink(ctx, source.Name)
+	}
+	return os.ReadFile(source.Name)
+}
 
-		resp.Body.Close()
+// writeSource wraps content in a <file name="..."> or <link url="...">
+// tag. the id is only added for sources the session knows about
+func writeSource(w *bytes.Buffer, source Source, content []byte) {
+	attr := "name"
+	if source.Kind == SourceLink {
+		attr = "url"
 	}
+	if source.ID > 0 {
+		fmt.Fprintf(w, "<%s id=\"%d\" %s=%q>\n", source.Kind, source.ID, attr, source.Name)
+	} else {
+		fmt.Fprintf(w, "<%s %s=%q>\n", source.Kind, attr, source.Name)
+	}
+	w.Write(content)
+	fmt.Fprintf(w, "\n</%s>\n", source.Kind)
+}
+
+// linkClient gives up on links that don't answer so a prompt with one
+// can't hang
+var linkClient = &http.Client{Timeout: fetchTimeout}
 
-	embedded := embed(urlContents.Bytes(), cmd.Loc, prompt)
-	return embedded, nil
+func fetchLink(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := linkClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
 }
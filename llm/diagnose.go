@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Hassan-Ibrahim-1/research/command"
+)
+
+// Diagnose returns the problems with the commands in prompt that would make
+// sending it fail: syntax errors, unknown commands and bad arguments. The
+// commands aren't run so nothing is read or fetched.
+func Diagnose(prompt string) []command.Diagnostic {
+	cmds, diagnostics := command.Parse([]byte(prompt))
+	for _, cmd := range cmds {
+		_, err := checkCommand(cmd)
+		if err == nil {
+			continue
+		}
+		var d command.Diagnostic
+		if !errors.As(err, &d) {
+			d = command.Diagnostic{Message: err.Error()}
+		}
+		d.Loc = cmd.Loc
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
+
+// checkCommand returns the command cmd runs or the error it would fail
+// with before anything is read
+func checkCommand(cmd command.Command) (PromptCommand, error) {
+	c, ok := lookupCommand(cmd.Name)
+	if !ok {
+		return c, unknownCommand(cmd.Name)
+	}
+	return c, c.check(cmd)
+}
+
+func unknownCommand(name string) error {
+	d := command.Diagnostic{Message: fmt.Sprintf("Unknown command @%s", name)}
+	names := commandNames()
+	if suggestion := command.Suggest(name, names); suggestion != "" {
+		d.Suggestion = fmt.Sprintf("did you mean @%s?", suggestion)
+	} else {
+		d.Suggestion = "acceptable commands are: " + strings.Join(names, ", ")
+	}
+	return d
+}
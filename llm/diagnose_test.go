@@ -0,0 +1,79 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Hassan-Ibrahim-1/research/command"
+)
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []command.Diagnostic
+	}{
+		{"no commands, just me@example.com", nil},
+		{"@file(main.go, lines=1-2) @text(hi)", nil},
+		{
+			"read @fiel(main.go)",
+			[]command.Diagnostic{{
+				Message:    "Unknown command @fiel",
+				Loc:        command.Range{Start: 5, End: 19},
+				Suggestion: "did you mean @file?",
+			}},
+		},
+		{
+			"@image(a.png)",
+			[]command.Diagnostic{{
+				Message:    "Unknown command @image",
+				Loc:        command.Range{Start: 0, End: 13},
+				Suggestion: "acceptable commands are: file, attach-file, link, attach-link, text",
+			}},
+		},
+		{
+			"@link(mode=text)",
+			[]command.Diagnostic{{
+				Message: "@link needs a link",
+				Loc:     command.Range{Start: 0, End: 16},
+			}},
+		},
+		{
+			"@file(a.md, lines=x) @file(b.md",
+			[]command.Diagnostic{
+				{
+					Message:    "Expected ')'",
+					Loc:        command.Range{Start: 21, End: 31},
+					Suggestion: "close it with ')' or escape the @ with \\@ if it isn't a command",
+				},
+				{
+					Message: `Invalid lines for @file: expected a range of lines like 10-80 got "x"`,
+					Loc:     command.Range{Start: 0, End: 20},
+				},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			got := Diagnose(tt.input)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("got=%+v. expected=%+v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("got=%+v. expected=%+v", got[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUnknownCommandError(t *testing.T) {
+	s := NewSession("model", nil)
+	_, err := s.executePromptCommands(context.Background(), []byte("@lnik(example.com)"))
+	expected := "Unknown command @lnik. did you mean @link?"
+	if err == nil || err.Error() != expected {
+		t.Errorf("got=%v. expected=%q", err, expected)
+	}
+}
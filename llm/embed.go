@@ -16,3 +16,25 @@ func embed(str []byte, rng command.Range, data []byte) []byte {
 	s = slices.Insert(s, rng.Start, data...)
 	return s
 }
+
+// replacement is the text a command in a prompt expands to
+type replacement struct {
+	loc  command.Range
+	data []byte
+}
+
+// splice replaces every range in str with its data. the ranges are offsets
+// into str so they're replaced from last to first, that way replacing one
+// doesn't move the ones before it. str isn't modified
+func splice(str []byte, replacements []replacement) []byte {
+	sorted := slices.Clone(replacements)
+	slices.SortFunc(sorted, func(a, b replacement) int {
+		return a.loc.Start - b.loc.Start
+	})
+
+	s := slices.Clone(str)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		s = embed(s, sorted[i].loc, sorted[i].data)
+	}
+	return s
+}
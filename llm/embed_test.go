@@ -1,7 +1,10 @@
 package llm
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -42,3 +45,86 @@ func TestEmbed(t *testing.T) {
 		})
 	}
 }
+
+func TestSplice(t *testing.T) {
+	tests := []struct {
+		s            string
+		replacements []replacement
+		expected     string
+	}{
+		{"abc", nil, "abc"},
+		{
+			"a XX b YY c",
+			[]replacement{{command.Range{Start: 2, End: 4}, []byte("longer")}, {command.Range{Start: 7, End: 9}, []byte("1")}},
+			"a longer b 1 c",
+		},
+		// out of order and adjacent
+		{
+			"XXYY",
+			[]replacement{{command.Range{Start: 2, End: 4}, []byte("b")}, {command.Range{Start: 0, End: 2}, []byte("aaa")}},
+			"aaab",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			original := []byte(tt.s)
+			s := string(splice(original, tt.replacements))
+			if s != tt.expected {
+				t.Errorf("got=%q. expected=%q", s, tt.expected)
+			}
+			if string(original) != tt.s {
+				t.Errorf("the original was modified. got=%q", original)
+			}
+		})
+	}
+}
+
+func TestExecutePromptCommands(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("AAA"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("B"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tag := func(id int, name, content string) string {
+		return fmt.Sprintf("<file id=\"%d\" name=%q>\n%s\n</file>\n", id, name, content)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"@text(one) and @text(two)", "one and two"},
+		{"@text(a much longer expansion)@text(x)@text(y)", "a much longer expansionxy"},
+		{"héllo wörld 🌍 @text(a) → @text(b, c)!", "héllo wörld 🌍 a → b, c!"},
+		{
+			fmt.Sprintf("compare @file(%s) with @text(this) and @file(%s).", a, b),
+			"compare " + tag(1, a, "AAA") + " with this and " + tag(2, b, "B") + ".",
+		},
+		{
+			fmt.Sprintf("@file(%s)@file(%s, %s)", b, a, b),
+			tag(2, b, "B") + tag(1, a, "AAA") + tag(2, b, "B"),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			s := NewSession("test", &fakeBackend{})
+			s.addSource(SourceFile, a)
+			s.addSource(SourceFile, b)
+
+			got, err := s.executePromptCommands(context.Background(), []byte(tt.input))
+			if err != nil {
+				t.Fatalf("executePromptCommands failed: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("got=%q. expected=%q", got, tt.expected)
+			}
+		})
+	}
+}
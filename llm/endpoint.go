@@ -0,0 +1,202 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// how long a health check waits for the server before giving up
+const pingTimeout = 5 * time.Second
+
+// Endpoint describes how to reach a model server. Token and Headers are
+// useful when the server sits behind a reverse proxy.
+type Endpoint struct {
+	// base url of the server
+	URL string
+
+	// sent as a bearer token in the Authorization header if not empty
+	Token string
+
+	// extra headers sent with every request
+	Headers map[string]string
+}
+
+func (e Endpoint) newRequest(
+	ctx context.Context,
+	method string,
+	path string,
+	body io.Reader,
+) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		method,
+		strings.TrimSuffix(e.URL, "/")+path,
+		body,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if e.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+e.Token)
+	}
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// do sends req and wraps errors from failing to reach the server in
+// ErrServerUnreachable
+func (e Endpoint) do(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("%w: %s: %w", ErrServerUnreachable, e.URL, err)
+	}
+	return resp, nil
+}
+
+// sendJSON sends body (if it isn't nil) as json and decodes the response
+// into v. The response must have a 200 status.
+func (e Endpoint) sendJSON(
+	ctx context.Context,
+	method string,
+	path string,
+	body any,
+	v any,
+) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := e.newRequest(ctx, method, path, r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// statusError turns a response with an unexpected status into an error.
+// Both ollama and OpenAI compatible servers put an explanation in the body
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	var ollamaErr struct {
+		Error string `json:"error"`
+	}
+	var openAIErr struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	msg := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &ollamaErr) == nil && ollamaErr.Error != "" {
+		msg = ollamaErr.Error
+	} else if json.Unmarshal(body, &openAIErr) == nil && openAIErr.Error.Message != "" {
+		msg = openAIErr.Error.Message
+	}
+
+	return &statusCodeError{
+		code:   resp.StatusCode,
+		status: resp.Status,
+		msg:    msg,
+	}
+}
+
+type statusCodeError struct {
+	code   int
+	status string
+	msg    string
+}
+
+func (e *statusCodeError) Error() string {
+	if e.msg == "" {
+		return "server responded with " + e.status
+	}
+	return fmt.Sprintf("server responded with %s: %s", e.status, e.msg)
+}
+
+// ping sends a GET request to path and returns an error if the server
+// can't be reached or doesn't respond with 200
+func (e Endpoint) ping(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	req, err := e.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrServerUnreachable, e.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", e.URL, resp.Status)
+	}
+	return nil
+}
+
+// ParseOllamaHost turns a value of OLLAMA_HOST into a url. Like ollama
+// it accepts a bare host, host:port or a full url and fills in the
+// default scheme and port when they are missing.
+func ParseOllamaHost(host string) (string, error) {
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return OLLAMA_URL, nil
+	}
+
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", fmt.Errorf("Invalid ollama host %q: %w", host, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("Invalid ollama host %q: missing host", host)
+	}
+
+	if u.Port() == "" {
+		port := "11434"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
@@ -0,0 +1,72 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseOllamaHost(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", OLLAMA_URL},
+		{"0.0.0.0", "http://0.0.0.0:11434"},
+		{"192.168.1.20:8080", "http://192.168.1.20:8080"},
+		{"desktop.local", "http://desktop.local:11434"},
+		{"http://desktop.local", "http://desktop.local:11434"},
+		{"https://ollama.example.com", "https://ollama.example.com:443"},
+		{"https://example.com/ollama/", "https://example.com:443/ollama"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			url, err := ParseOllamaHost(tt.input)
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", tt.input, err)
+			}
+			if url != tt.expected {
+				t.Errorf("bad url. got=%q. expected=%q", url, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEndpointHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+				t.Errorf("unexpected authorization header %q", auth)
+			}
+			if v := r.Header.Get("X-Proxy"); v != "research" {
+				t.Errorf("unexpected X-Proxy header %q", v)
+			}
+			if r.URL.Path != "/proxy/api/version" {
+				t.Errorf("unexpected path %q", r.URL.Path)
+			}
+			fmt.Fprint(w, `{"version":"0.9.0"}`)
+		},
+	))
+	defer server.Close()
+
+	o := NewOllama(Endpoint{
+		URL:     server.URL + "/proxy/",
+		Token:   "secret",
+		Headers: map[string]string{"X-Proxy": "research"},
+	})
+	if err := o.Ping(); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+}
+
+func TestPingUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	if err := NewOllama(Endpoint{URL: url}).Ping(); err == nil {
+		t.Errorf("expected Ping to fail for a closed server")
+	}
+}
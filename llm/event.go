@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"context"
+	"time"
+)
+
+// Event is sent on the stream returned by Session.SendPrompt and
+// Backend.Chat. It is one of Token, Thinking, Error, Compacted, Done or
+// one of the tool events. Compacted, ToolRequested and ToolFinished are
+// only sent by Session.SendPrompt and ToolCalls only by backends.
+// Session.Research sends ResearchStep as well.
+//
+// A stream ends with either an Error or a Done. If the stream's context
+// is cancelled it may be closed without either.
+type Event interface {
+	event()
+}
+
+// Token is a chunk of the model's answer.
+type Token struct {
+	Content string
+}
+
+// Thinking is a chunk of the model's reasoning. Only sent by models that
+// think before they answer.
+type Thinking struct {
+	Content string
+}
+
+// Error is sent when generation fails part way through, e.g. when the
+// connection drops or the server sends something that can't be decoded.
+type Error struct {
+	Err error
+}
+
+// Done is sent once the model has finished its answer.
+type Done struct {
+	Stats Stats
+}
+
+// Compacted is sent when older messages were summarized because the
+// history went over the session's token budget.
+type Compacted struct {
+	// number of messages that were replaced by the summary
+	Summarized int
+
+	// set if the summary failed. the history is left as is
+	Err error
+}
+
+func (Token) event()     {}
+func (Compacted) event() {}
+func (Thinking) event()  {}
+func (Error) event()     {}
+func (Done) event()      {}
+
+// Stats describes how a response was generated. Apart from Duration
+// every field is reported by the server and is zero if the server doesn't
+// report it.
+type Stats struct {
+	// time between sending the request and receiving the last chunk
+	Duration time.Duration `json:"duration"`
+
+	TotalDuration time.Duration `json:"total_duration,omitempty"`
+
+	// time spent loading the model into memory. this is only non zero
+	// when the model wasn't already loaded
+	LoadDuration time.Duration `json:"load_duration,omitempty"`
+
+	// number of tokens in the prompt that had to be evaluated. if this
+	// grows every turn the whole conversation is being re-evaluated
+	PromptEvalCount    int           `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration time.Duration `json:"prompt_eval_duration,omitempty"`
+
+	// number of tokens in the answer
+	EvalCount    int           `json:"eval_count,omitempty"`
+	EvalDuration time.Duration `json:"eval_duration,omitempty"`
+}
+
+// TokensPerSecond returns how fast the answer was generated or 0 if the
+// server didn't report how many tokens it generated.
+func (s Stats) TokensPerSecond() float64 {
+	d := s.EvalDuration
+	if d == 0 {
+		d = s.Duration
+	}
+	if s.EvalCount == 0 || d == 0 {
+		return 0
+	}
+	return float64(s.EvalCount) / d.Seconds()
+}
+
+// send returns false if ctx was cancelled before ev could be sent
+func send(ctx context.Context, ch chan<- Event, ev Event) bool {
+	select {
+	case ch <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
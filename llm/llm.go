@@ -1,214 +1,414 @@
 package llm
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
-	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Hassan-Ibrahim-1/research/command"
 )
 
-type Request struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-	Stream bool   `json:"stream"`
-}
+// ChatRequest is everything a Backend needs to generate the next
+// assistant message.
+type ChatRequest struct {
+	Model    string
+	Messages []Message
+	Options  Options
 
-type Response struct {
-	Response string `json:"response"`
-	Done     bool   `json:"done"`
+	// tools the model may call, see ToolBackend
+	Tools []Tool
 }
 
+type Role string
+
 const (
-	OLLAMA_GENERATE_URL = "http://localhost:11434/api/generate"
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+	RoleTool      Role = "tool"
 )
 
-// each message consists of one user message and one llm message
-type message struct {
-	userPrompt  string
-	llmResponse string
-}
+// Message is a single turn in a conversation. Messages are sent to the
+// chat endpoint with their roles so the model's chat template decides how
+// they are formatted.
+type Message struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
 
-func newMessage(prompt, response string) message {
-	return message{
-		userPrompt:  prompt,
-		llmResponse: response,
-	}
+	// Raw is the prompt as it was typed when expanding its commands
+	// changed it. Content is what was sent to the model
+	Raw string `json:"raw,omitempty"`
+
+	// when the message was sent or the answer finished. zero for
+	// messages that weren't part of a conversation yet
+	Time time.Time `json:"time,omitzero"`
+
+	// Interrupted is set when generation was cancelled before the model
+	// finished its answer. Content holds whatever was received until then.
+	Interrupted bool `json:"interrupted,omitempty"`
+
+	// Stats is set on assistant messages that finished generating
+	Stats *Stats `json:"stats,omitempty"`
+
+	// Summary is set on the system message that replaces older messages
+	// once the history goes over the session's token budget
+	Summary bool `json:"summary,omitempty"`
+
+	// set on assistant messages where the model called tools. the tools'
+	// outputs follow in RoleTool messages with ToolName set
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+
+	// set on reports written by Session.Research
+	Research *ResearchRun `json:"research,omitempty"`
+
+	// the quotes in an answer checked against the attachments before it.
+	// they're checked once when the answer finishes, see verifyQuotes
+	Quotes []Quote `json:"quotes,omitempty"`
 }
 
-func (m message) String() string {
-	return fmt.Sprintf(
-		`<User Message>
-        %s
-        </User Message>
-        <Assistant Response>
-        %s
-        </Assistant Response>
-        `, m.userPrompt, m.llmResponse,
-	)
+func NewMessage(role Role, content string) Message {
+	return Message{
+		Role:    role,
+		Content: content,
+	}
 }
 
 type Session struct {
-	model string
+	// see Snapshot
+	id      string
+	title   string
+	created time.Time
 
-	mu       sync.Mutex
-	messages []message
+	model   string
+	backend Backend
+	options Options
+
+	// sent before the history with every prompt. empty means no system
+	// message is sent
+	systemPrompt string
+
+	// name of the persona that was last applied
+	persona string
+
+	// see TokenBudget
+	tokenBudget int
+
+	// see SetTools and SetConfirmTools
+	tools        []Tool
+	confirmTools bool
+
+	// see Sources
+	sources []Source
+
+	// the new sources attached to the prompt that's being sent, see
+	// attachSource
+	pending []Source
+
+	mu sync.Mutex
+
+	// every message that was sent or received, see Node. root's message
+	// isn't used
+	root Node
+
+	// the nodes on the current branch. Messages returns their messages
+	path []*Node
 }
 
-func NewSession(model string) Session {
+func NewSession(model string, backend Backend) Session {
+	now := time.Now()
 	return Session{
-		model: model,
+		id:           newSessionID(now),
+		created:      now,
+		model:        model,
+		backend:      backend,
+		confirmTools: true,
 	}
 }
 
-func (s *Session) executePromptCommands(prompt []byte) ([]byte, error) {
-	var (
-		err       error
-		newPrompt = prompt
-	)
+// executePromptCommands expands every command in prompt, see
+// PromptCommand. All of them are resolved before any is spliced in since
+// their locations are offsets into the prompt as it was typed.
+func (s *Session) executePromptCommands(ctx context.Context, prompt []byte) ([]byte, error) {
+	cmds, diagnostics := command.Parse(prompt)
+	if len(diagnostics) > 0 {
+		return nil, diagnostics[0]
+	}
+	replacements := make([]replacement, 0, len(cmds))
 
-	cmds := command.Parse(prompt)
 	for _, cmd := range cmds {
-		switch cmd.Name {
-		case "attach-file", "file":
-			newPrompt, err = s.attachFile(cmd, newPrompt)
-			if err != nil {
-				return nil, fmt.Errorf(
-					"Failed to embed files %+v: %w",
-					cmd.Arguments,
-					err,
-				)
-			}
-
-		case "attach-link", "link":
-			newPrompt, err = s.attachLink(cmd, newPrompt)
-			if err != nil {
-				return nil, fmt.Errorf(
-					"Failed to embed links %+v: %w",
-					cmd.Arguments,
-					err,
-				)
-			}
-
-		case "text":
-			// mostly for testing purposes
-			data := []byte(strings.Join(cmd.Arguments, ", "))
-			newPrompt = embed(newPrompt, cmd.Loc, data)
-
-		default:
-			return nil, fmt.Errorf(
-				"Invalid command %q. acceptable commands are: attach-file, file, attach-link, link",
-				cmd.Name,
-			)
+		c, err := checkCommand(cmd)
+		if err != nil {
+			return nil, err
+		}
+		data, err := c.Run(ctx, s, cmd)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to run %s: %w", cmd, err)
 		}
+		replacements = append(replacements, replacement{cmd.Loc, data})
 	}
 
-	return newPrompt, nil
+	return splice(prompt, replacements), nil
 }
 
-func (s *Session) constructPrompt(str string) (string, error) {
-	prompt := []byte(str)
+// constructMessages expands any commands in str and returns the system
+// prompt and history followed by the new user message.
+func (s *Session) constructMessages(ctx context.Context, str string) ([]Message, error) {
+	s.mu.Lock()
+	s.pending = nil
+	s.mu.Unlock()
 
-	prompt, err := s.executePromptCommands(prompt)
+	prompt, err := s.executePromptCommands(ctx, []byte(str))
 	if err != nil {
-		return "", fmt.Errorf("Failed to execute prompt commands: %w", err)
+		return nil, fmt.Errorf("Failed to execute prompt commands: %w", err)
 	}
 
-	b := strings.Builder{}
-	for _, msg := range s.messages {
-		b.WriteString(msg.String())
+	msg := NewMessage(RoleUser, string(prompt))
+	if len(parseAttachments(msg.Content)) > 0 {
+		msg.Content += citeInstruction
+	}
+	if msg.Content != str {
+		msg.Raw = str
 	}
 
-	b.WriteString(fmt.Sprintf("<User Prompt>\n%s\n</User Prompt>\n", prompt))
-	return b.String(), nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requestMessages(msg), nil
+}
+
+// requestMessages returns the system prompt and history followed by msgs.
+// s.mu must be held
+func (s *Session) requestMessages(msgs ...Message) []Message {
+	messages := make([]Message, 0, len(s.path)+len(msgs)+1)
+	if s.systemPrompt != "" {
+		messages = append(messages, NewMessage(RoleSystem, s.systemPrompt))
+	}
+	messages = append(messages, s.history()...)
+	return append(messages, msgs...)
 }
 
-func (s *Session) SendPrompt(prompt string) (<-chan string, error) {
-	fullPrompt, err := s.constructPrompt(prompt)
+// SendPrompt streams the model's answer to prompt. Cancelling ctx stops
+// generation. If generation is cancelled or fails the partial answer is
+// kept in the history and marked as interrupted.
+//
+// Once the answer is complete, if the history is over the token budget the
+// oldest messages are summarized and a Compacted event is sent before Done.
+func (s *Session) SendPrompt(
+	ctx context.Context,
+	prompt string,
+) (<-chan Event, error) {
+	messages, err := s.constructMessages(ctx, prompt)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to construct prompt: %w", err)
 	}
 
-	request := Request{
-		Model:  s.model,
-		Prompt: fullPrompt,
-		Stream: true,
-	}
+	question := messages[len(messages)-1]
+	return s.respond(ctx, messages, &question)
+}
 
-	requestJson, err := json.Marshal(request)
-	if err != nil {
-		return nil, err
+// respond streams the answer to messages. question is added to the history
+// before the answer unless it's nil because it's already in the history.
+func (s *Session) respond(
+	ctx context.Context,
+	messages []Message,
+	question *Message,
+) (<-chan Event, error) {
+	s.mu.Lock()
+	request := ChatRequest{
+		Model:    s.model,
+		Messages: messages,
+		Options:  s.options,
+		Tools:    s.tools,
 	}
+	s.mu.Unlock()
 
-	resp, err := http.Post(
-		OLLAMA_GENERATE_URL,
-		"application/json",
-		bytes.NewReader(requestJson),
-	)
+	response, err := s.backend.Chat(ctx, request)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode == 404 {
-		return nil, fmt.Errorf(
-			"%s is either not running or is not a valid model",
-			s.model,
-		)
-	}
-
-	log.Println("got a response", resp)
-
-	ch := make(chan string)
+	sent := time.Now()
+	ch := make(chan Event)
 
 	go func() {
-		defer resp.Body.Close()
 		defer close(ch)
 
-		var fullResponse strings.Builder
+		// everything that's added to the history once the model answers
+		var added []Message
+		if question != nil {
+			q := *question
+			q.Time = sent
+			added = append(added, q)
+		}
+
+		var (
+			fullResponse strings.Builder
+			calls        []ToolCall
 
-		scanner := bufio.NewScanner(resp.Body)
-		for scanner.Scan() {
-			line := scanner.Bytes()
-			if line == nil {
-				continue
+			// the Done or Error that ended the stream. it's sent after the
+			// answer is added to the history
+			last Event
+		)
+		for round := 0; ; round++ {
+			// a stream that's cancelled ends without a Done or Error so the
+			// previous round's Done mustn't be taken for this one's
+			last = nil
+			for ev := range response {
+				switch ev := ev.(type) {
+				case Token:
+					fullResponse.WriteString(ev.Content)
+				case ToolCalls:
+					calls = append(calls, ev.Calls...)
+					continue
+				case Done, Error:
+					last = ev
+					continue
+				}
+				send(ctx, ch, ev)
 			}
 
-			var partialResponse Response
-			err = json.Unmarshal(line, &partialResponse)
-			if err != nil {
-				log.Println("Session err:", err)
-				continue
+			if _, finished := last.(Done); !finished || len(calls) == 0 {
+				break
+			}
+			if round == maxToolRounds {
+				last = Error{fmt.Errorf("The model called tools more than %d times", maxToolRounds)}
+				break
 			}
 
-			if resp := partialResponse.Response; resp != "" {
-				fullResponse.WriteString(resp)
-				log.Println("partial response:", resp)
-				ch <- resp
+			// the model continues once it has the tools' outputs
+			call := NewMessage(RoleAssistant, fullResponse.String())
+			call.ToolCalls = calls
+			call.Time = time.Now()
+			turn := []Message{call}
+			fullResponse.Reset()
+			calls = nil
+
+			for _, c := range call.ToolCalls {
+				result, ok := s.runTool(ctx, ch, c)
+				if !ok {
+					break
+				}
+				result.Time = time.Now()
+				turn = append(turn, result)
+			}
+			added = append(added, turn...)
+			if len(turn) <= len(call.ToolCalls) {
+				// cancelled while running the tools
+				last = nil
+				break
 			}
 
-			if partialResponse.Done {
+			request.Messages = append(request.Messages, turn...)
+			next, err := s.backend.Chat(ctx, request)
+			if err != nil {
+				last = Error{err}
 				break
 			}
+			response = next
+		}
+
+		answer := NewMessage(RoleAssistant, fullResponse.String())
+		answer.Time = time.Now()
+		answer.Quotes = verifyQuotes(answer.Content, request.Messages)
+		done, finished := last.(Done)
+		if finished {
+			answer.Stats = &done.Stats
+		} else {
+			answer.Interrupted = true
+		}
+		s.mu.Lock()
+		if question != nil {
+			// the question's sources keep their ids now that it's in the
+			// history
+			s.commitSources()
 		}
+		s.appendToPath(append(added, answer)...)
+		s.mu.Unlock()
 
-		if err := scanner.Err(); err != nil {
-			log.Println("error reading streaming response:", err)
-			return
+		if finished {
+			if compacted, ok := s.compact(ctx); ok {
+				send(ctx, ch, compacted)
+			}
 		}
 
-		s.addMessage(newMessage(prompt, fullResponse.String()))
+		if last != nil {
+			send(ctx, ch, last)
+		}
 	}()
 
 	return ch, nil
 }
 
-func (s *Session) addMessage(msg message) {
+func (s *Session) addMessages(msgs ...Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appendToPath(msgs...)
+}
+
+// Messages returns a copy of the conversation history.
+func (s *Session) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.history()
+}
+
+func (s *Session) Model() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.model
+}
+
+func (s *Session) Options() Options {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.options
+}
+
+// SetOptions replaces the options used for the following prompts.
+func (s *Session) SetOptions(options Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.options = options
+}
+
+func (s *Session) SystemPrompt() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.systemPrompt
+}
+
+// SetSystemPrompt changes the system prompt for the following prompts.
+// The history is kept as is.
+func (s *Session) SetSystemPrompt(prompt string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.systemPrompt = prompt
+}
+
+// Persona returns the name of the persona that was last applied or an
+// empty string if there isn't one.
+func (s *Session) Persona() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.persona
+}
+
+// SetPersona switches to p's system prompt and model. p's options are
+// set on top of the current ones. The history is kept as is.
+func (s *Session) SetPersona(p Persona) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.messages = append(s.messages, msg)
+	s.persona = p.Name
+	s.systemPrompt = p.SystemPrompt
+	if p.Model != "" {
+		s.model = p.Model
+	}
+	s.options.Merge(p.Options)
+}
+
+// Ping checks that the session's backend can be reached.
+func (s *Session) Ping() error {
+	return s.backend.Ping()
 }
@@ -1,35 +1,271 @@
 package llm
 
 import (
+	"context"
+	"reflect"
 	"testing"
 )
 
-func TestConstructPrompt(t *testing.T) {
+func TestConstructMessages(t *testing.T) {
 	tests := []struct {
-		input    string
-		expected string
+		systemPrompt string
+		history      []Message
+		input        string
+		expected     []Message
 	}{
-		{"Hey", "<User Prompt>\nHey\n</User Prompt>\n"},
 		{
+			"",
+			nil,
+			"Hey",
+			[]Message{NewMessage(RoleUser, "Hey")},
+		},
+		{
+			"",
+			nil,
 			"Hello, @text(World!)",
-			"<User Prompt>\nHello, World!\n</User Prompt>\n",
+			[]Message{{
+				Role:    RoleUser,
+				Content: "Hello, World!",
+				Raw:     "Hello, @text(World!)",
+			}},
+		},
+		{
+			"",
+			[]Message{
+				NewMessage(RoleUser, "Hey"),
+				NewMessage(RoleAssistant, "Hello!"),
+			},
+			"How are you?",
+			[]Message{
+				NewMessage(RoleUser, "Hey"),
+				NewMessage(RoleAssistant, "Hello!"),
+				NewMessage(RoleUser, "How are you?"),
+			},
+		},
+		{
+			"You are terse.",
+			[]Message{
+				NewMessage(RoleUser, "Hey"),
+				NewMessage(RoleAssistant, "Hi."),
+			},
+			"How are you?",
+			[]Message{
+				NewMessage(RoleSystem, "You are terse."),
+				NewMessage(RoleUser, "Hey"),
+				NewMessage(RoleAssistant, "Hi."),
+				NewMessage(RoleUser, "How are you?"),
+			},
 		},
 	}
 
 	for _, tt := range tests {
-		s := Session{}
-		prompt, err := s.constructPrompt(tt.input)
+		s := Session{systemPrompt: tt.systemPrompt}
+		s.setHistory(tt.history)
+		messages, err := s.constructMessages(context.Background(), tt.input)
 		if err != nil {
 			t.Errorf(
-				"Failed to construct prompt with input %s, %v",
+				"Failed to construct messages with input %s, %v",
 				tt.input,
 				err,
 			)
 			continue
 		}
 
-		if prompt != tt.expected {
-			t.Errorf("invalid prompt: got=%q, expected=%q", prompt, tt.expected)
+		if !reflect.DeepEqual(messages, tt.expected) {
+			t.Errorf(
+				"invalid messages: got=%+v, expected=%+v",
+				messages,
+				tt.expected,
+			)
 		}
 	}
 }
+
+func TestSetPersona(t *testing.T) {
+	s := NewSession("mistral", nil)
+	_ = s.options.Set("temperature", "0.7")
+	_ = s.options.Set("num_ctx", "4096")
+
+	var options Options
+	_ = options.Set("temperature", "0.1")
+	s.SetPersona(Persona{
+		Name:         "code reviewer",
+		SystemPrompt: "You review code.",
+		Model:        "qwen2.5-coder",
+		Options:      options,
+	})
+
+	if s.Model() != "qwen2.5-coder" {
+		t.Errorf("expected the persona's model. got=%q", s.Model())
+	}
+	if s.SystemPrompt() != "You review code." || s.Persona() != "code reviewer" {
+		t.Errorf("persona not applied. got=%q, %q", s.SystemPrompt(), s.Persona())
+	}
+	if o := s.Options().String(); o != "temperature=0.1 num_ctx=4096" {
+		t.Errorf("expected the persona's options on top of the session's. got=%q", o)
+	}
+
+	s.SetPersona(Persona{Name: "plain"})
+	if s.Model() != "qwen2.5-coder" {
+		t.Errorf("a persona without a model should keep the current one. got=%q", s.Model())
+	}
+}
+
+// fakeBackend records every request and answers it with what reply returns
+// for it. Without reply every request is answered with chunks.
+type fakeBackend struct {
+	chunks []string
+	block  bool
+
+	// reply scripts the answer to the n-th request, counted from 0
+	reply func(n int, req ChatRequest) fakeReply
+
+	// whether the backend supports tools, see ToolBackend
+	tools bool
+
+	requests []ChatRequest
+}
+
+// fakeReply is streamed as tokens followed by the tool calls. If block is
+// set the stream then waits for ctx to be cancelled instead of sending Done.
+type fakeReply struct {
+	chunks []string
+	calls  []ToolCall
+	block  bool
+}
+
+func (f *fakeBackend) Chat(
+	ctx context.Context,
+	req ChatRequest,
+) (<-chan Event, error) {
+	n := len(f.requests)
+	f.requests = append(f.requests, req)
+
+	reply := fakeReply{chunks: f.chunks, block: f.block}
+	if f.reply != nil {
+		reply = f.reply(n, req)
+	}
+
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		for _, chunk := range reply.chunks {
+			if !send(ctx, ch, Token{chunk}) {
+				return
+			}
+		}
+		if len(reply.calls) > 0 && !send(ctx, ch, ToolCalls{reply.calls}) {
+			return
+		}
+		if reply.block {
+			<-ctx.Done()
+			return
+		}
+		send(ctx, ch, Done{Stats: Stats{EvalCount: len(reply.chunks)}})
+	}()
+	return ch, nil
+}
+
+func (f *fakeBackend) Ping() error {
+	return nil
+}
+
+func (f *fakeBackend) SupportsTools() bool {
+	return f.tools
+}
+
+func TestSendPrompt(t *testing.T) {
+	s := NewSession("test", &fakeBackend{chunks: []string{"Hello", "!"}})
+
+	ch, err := s.SendPrompt(context.Background(), "Hey")
+	if err != nil {
+		t.Fatalf("SendPrompt failed: %v", err)
+	}
+	var last Event
+	for ev := range ch {
+		last = ev
+	}
+	if _, ok := last.(Done); !ok {
+		t.Errorf("expected the stream to end with Done. got=%+v", last)
+	}
+
+	messages := s.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages in history. got=%+v", messages)
+	}
+	if messages[0].Role != RoleUser || messages[0].Content != "Hey" {
+		t.Errorf("bad user message. got=%+v", messages[0])
+	}
+	if messages[0].Time.IsZero() || messages[1].Time.Before(messages[0].Time) {
+		t.Errorf("bad message times. got=%v, %v", messages[0].Time, messages[1].Time)
+	}
+
+	answer := messages[1]
+	if answer.Role != RoleAssistant || answer.Content != "Hello!" {
+		t.Errorf("bad answer. got=%+v", answer)
+	}
+	if answer.Stats == nil || answer.Stats.EvalCount != 2 {
+		t.Errorf("expected the answer to have stats. got=%+v", answer.Stats)
+	}
+}
+
+func TestSendPromptCancel(t *testing.T) {
+	s := NewSession(
+		"test",
+		&fakeBackend{chunks: []string{"Hel"}, block: true},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := s.SendPrompt(ctx, "Hey")
+	if err != nil {
+		t.Fatalf("SendPrompt failed: %v", err)
+	}
+
+	if ev := <-ch; ev != (Token{"Hel"}) {
+		t.Fatalf("bad event. got=%+v", ev)
+	}
+	cancel()
+	for range ch {
+	}
+
+	messages := s.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages in history. got=%+v", messages)
+	}
+	answer := messages[1]
+	if answer.Content != "Hel" || !answer.Interrupted {
+		t.Errorf("expected an interrupted partial answer. got=%+v", answer)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	s := NewSession("mistral", &fakeBackend{chunks: []string{"Hi"}})
+	s.SetSystemPrompt("Be brief.")
+	_ = s.options.Set("seed", "42")
+
+	ch, err := s.SendPrompt(context.Background(), "Hey")
+	if err != nil {
+		t.Fatalf("SendPrompt failed: %v", err)
+	}
+	for range ch {
+	}
+
+	snap := s.Snapshot()
+	if snap.Version != SnapshotVersion || snap.ID != s.ID() {
+		t.Errorf("bad snapshot. got=%+v", snap)
+	}
+	if !snap.Updated.Equal(s.Messages()[1].Time) {
+		t.Errorf("expected updated to be the last message's time. got=%v", snap.Updated)
+	}
+
+	restored := NewSession("other", nil)
+	restored.Restore(snap)
+	if restored.ID() != s.ID() || restored.Model() != "mistral" ||
+		restored.SystemPrompt() != "Be brief." ||
+		restored.Options().String() != "seed=42" {
+		t.Errorf("session not restored. got=%+v", restored.Snapshot())
+	}
+	if !reflect.DeepEqual(restored.Messages(), s.Messages()) {
+		t.Errorf("bad messages. got=%+v. expected=%+v", restored.Messages(), s.Messages())
+	}
+}
@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrServerUnreachable is returned when the model server can't be
+	// connected to, e.g. because it isn't running or the host is wrong.
+	ErrServerUnreachable = errors.New("the model server is unreachable")
+
+	// ErrModelNotFound is returned when the server is running but doesn't
+	// have the requested model.
+	ErrModelNotFound = errors.New("model not found")
+
+	// ErrUnsupported is returned when the session's backend can't do what
+	// was asked of it.
+	ErrUnsupported = errors.New("not supported by this backend")
+)
+
+// ModelInfo is a model that's available on the server.
+type ModelInfo struct {
+	Name string
+
+	// zero if the server doesn't report it
+	Size       int64
+	ModifiedAt time.Time
+}
+
+// ModelDetails describes a single model in more depth than ModelInfo.
+type ModelDetails struct {
+	Name          string
+	Family        string
+	ParameterSize string
+	Quantization  string
+
+	// maximum context length the model was trained with. zero if unknown
+	ContextLength int
+}
+
+func (d ModelDetails) String() string {
+	s := d.Name
+	for _, detail := range []string{d.Family, d.ParameterSize, d.Quantization} {
+		if detail != "" {
+			s += " " + detail
+		}
+	}
+	if d.ContextLength > 0 {
+		s += fmt.Sprintf(" %d ctx", d.ContextLength)
+	}
+	return s
+}
+
+// ModelLister is implemented by backends that can list their models.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+}
+
+// ModelShower is implemented by backends that can describe a model.
+// ShowModel returns ErrModelNotFound if the model isn't installed.
+type ModelShower interface {
+	ShowModel(ctx context.Context, name string) (ModelDetails, error)
+}
+
+// ListModels returns the models available on the session's backend.
+func (s *Session) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	lister, ok := s.backend.(ModelLister)
+	if !ok {
+		return nil, fmt.Errorf("listing models is %w", ErrUnsupported)
+	}
+	return lister.ListModels(ctx)
+}
+
+// CheckModel makes sure name can be used with the session's backend. It
+// returns ErrServerUnreachable if the server is down and ErrModelNotFound
+// if the server is up but doesn't have the model.
+func (s *Session) CheckModel(ctx context.Context, name string) (ModelDetails, error) {
+	if shower, ok := s.backend.(ModelShower); ok {
+		return shower.ShowModel(ctx, name)
+	}
+
+	models, err := s.ListModels(ctx)
+	if errors.Is(err, ErrUnsupported) {
+		// nothing to check against so assume the model exists
+		return ModelDetails{Name: name}, nil
+	}
+	if err != nil {
+		return ModelDetails{}, err
+	}
+
+	for _, m := range models {
+		if m.Name == name {
+			return ModelDetails{Name: name}, nil
+		}
+	}
+	return ModelDetails{}, fmt.Errorf("%w: %s", ErrModelNotFound, name)
+}
+
+// SetModel switches the model used for the following prompts. The
+// history is kept as is.
+func (s *Session) SetModel(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.model = name
+}
+
+// PullProgress is sent while a model is being downloaded. The last one
+// sent has either Err set or a Status of "success".
+type PullProgress struct {
+	Status string
+
+	// bytes of the layer that's currently being downloaded. zero when
+	// the server is doing something other than downloading
+	Total     int64
+	Completed int64
+
+	Err error
+}
+
+// Fraction returns how much of the current layer has been downloaded
+// between 0 and 1.
+func (p PullProgress) Fraction() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+	return min(1, float64(p.Completed)/float64(p.Total))
+}
+
+// ModelPuller is implemented by backends that can download models.
+// The returned channel is closed once the pull finishes, fails or ctx is
+// cancelled.
+type ModelPuller interface {
+	PullModel(ctx context.Context, name string) (<-chan PullProgress, error)
+}
+
+// CanPullModels reports whether the session's backend can download models.
+func (s *Session) CanPullModels() bool {
+	_, ok := s.backend.(ModelPuller)
+	return ok
+}
+
+// PullModel downloads name onto the session's backend.
+func (s *Session) PullModel(
+	ctx context.Context,
+	name string,
+) (<-chan PullProgress, error) {
+	puller, ok := s.backend.(ModelPuller)
+	if !ok {
+		return nil, fmt.Errorf("pulling models is %w", ErrUnsupported)
+	}
+	return puller.PullModel(ctx, name)
+}
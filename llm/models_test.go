@@ -0,0 +1,183 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newFakeOllama() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"models":[
+			{"name":"mistral:latest","size":4109865159,"modified_at":"2025-06-01T10:00:00Z"},
+			{"name":"qwen2.5-coder:7b","size":4683087332,"modified_at":"2025-06-02T10:00:00Z"}
+		]}`)
+	})
+	mux.HandleFunc("POST /api/show", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"details":{"family":"llama","parameter_size":"7.2B","quantization_level":"Q4_0"},
+			"model_info":{"general.architecture":"llama","llama.context_length":32768}
+		}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestOllamaListModels(t *testing.T) {
+	server := newFakeOllama()
+	defer server.Close()
+
+	s := NewSession("mistral", NewOllama(Endpoint{URL: server.URL}))
+	models, err := s.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 2 || models[1].Name != "qwen2.5-coder:7b" {
+		t.Errorf("bad models. got=%+v", models)
+	}
+	if models[0].Size != 4109865159 || models[0].ModifiedAt.IsZero() {
+		t.Errorf("expected size and modified time. got=%+v", models[0])
+	}
+}
+
+func TestOllamaCheckModel(t *testing.T) {
+	server := newFakeOllama()
+	defer server.Close()
+
+	s := NewSession("mistral", NewOllama(Endpoint{URL: server.URL}))
+	details, err := s.CheckModel(context.Background(), "mistral")
+	if err != nil {
+		t.Fatalf("CheckModel failed: %v", err)
+	}
+	if details.String() != "mistral llama 7.2B Q4_0 32768 ctx" {
+		t.Errorf("bad details. got=%q", details.String())
+	}
+}
+
+func TestModelErrors(t *testing.T) {
+	notFound := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"model 'missing' not found"}`)
+		},
+	))
+	defer notFound.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		url      string
+		expected error
+	}{
+		{notFound.URL, ErrModelNotFound},
+		{closed.URL, ErrServerUnreachable},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			s := NewSession("missing", NewOllama(Endpoint{URL: tt.url}))
+
+			_, err := s.CheckModel(context.Background(), "missing")
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("CheckModel: expected %v. got=%v", tt.expected, err)
+			}
+
+			_, err = s.SendPrompt(context.Background(), "Hey")
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("SendPrompt: expected %v. got=%v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestCheckModelWithoutShow(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"data":[{"id":"llama-3.1-8b","created":1700000000}]}`)
+		},
+	))
+	defer server.Close()
+
+	s := NewSession("llama-3.1-8b", NewOpenAI(Endpoint{URL: server.URL}))
+	if _, err := s.CheckModel(context.Background(), "llama-3.1-8b"); err != nil {
+		t.Errorf("CheckModel failed: %v", err)
+	}
+	_, err := s.CheckModel(context.Background(), "mistral")
+	if !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("expected ErrModelNotFound. got=%v", err)
+	}
+}
+
+func TestOllamaPullModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/pull" {
+				t.Errorf("unexpected path %q", r.URL.Path)
+			}
+			fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+			fmt.Fprintln(w, `{"status":"pulling 6a0746a1ec1a","digest":"sha256:6a0746a1ec1a","total":100,"completed":25}`)
+			fmt.Fprintln(w, `{"status":"pulling 6a0746a1ec1a","digest":"sha256:6a0746a1ec1a","total":100,"completed":100}`)
+			fmt.Fprintln(w, `{"status":"verifying sha256 digest"}`)
+			fmt.Fprintln(w, `{"status":"success"}`)
+		},
+	))
+	defer server.Close()
+
+	s := NewSession("mistral", NewOllama(Endpoint{URL: server.URL}))
+	if !s.CanPullModels() {
+		t.Fatalf("expected ollama to be able to pull models")
+	}
+
+	ch, err := s.PullModel(context.Background(), "mistral")
+	if err != nil {
+		t.Fatalf("PullModel failed: %v", err)
+	}
+
+	var progress []PullProgress
+	for p := range ch {
+		progress = append(progress, p)
+	}
+
+	if len(progress) != 5 {
+		t.Fatalf("expected 5 progress updates. got=%+v", progress)
+	}
+	if f := progress[1].Fraction(); f != 0.25 {
+		t.Errorf("bad fraction. got=%f. expected=0.25", f)
+	}
+	if last := progress[len(progress)-1]; last.Status != "success" || last.Err != nil {
+		t.Errorf("expected the pull to succeed. got=%+v", last)
+	}
+}
+
+func TestOllamaPullModelError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+			fmt.Fprintln(w, `{"error":"pull model manifest: file does not exist"}`)
+		},
+	))
+	defer server.Close()
+
+	s := NewSession("missing", NewOllama(Endpoint{URL: server.URL}))
+	ch, err := s.PullModel(context.Background(), "missing")
+	if err != nil {
+		t.Fatalf("PullModel failed: %v", err)
+	}
+
+	var last PullProgress
+	for p := range ch {
+		last = p
+	}
+	if last.Err == nil {
+		t.Errorf("expected the pull to fail. got=%+v", last)
+	}
+
+	openAI := NewSession("x", NewOpenAI(Endpoint{}))
+	if openAI.CanPullModels() {
+		t.Errorf("the openai backend can't pull models")
+	}
+}
@@ -0,0 +1,396 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	OLLAMA_URL = "http://localhost:11434"
+)
+
+type ollamaChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Tools    []ollamaTool  `json:"tools,omitempty"`
+	Stream   bool          `json:"stream"`
+	Options  Options       `json:"options"`
+}
+
+// ollamaTool describes a Tool with a json schema
+type ollamaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string               `json:"name"`
+		Description string               `json:"description"`
+		Parameters  ollamaToolParameters `json:"parameters"`
+	} `json:"function"`
+}
+
+type ollamaToolParameters struct {
+	Type       string                        `json:"type"`
+	Properties map[string]ollamaToolProperty `json:"properties"`
+	Required   []string                      `json:"required"`
+}
+
+type ollamaToolProperty struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+func toOllamaTools(tools []Tool) []ollamaTool {
+	var ret []ollamaTool
+	for _, tool := range tools {
+		params := ollamaToolParameters{
+			Type:       "object",
+			Properties: map[string]ollamaToolProperty{},
+			Required:   []string{},
+		}
+		for _, p := range tool.Parameters {
+			params.Properties[p.Name] = ollamaToolProperty{p.Type, p.Description}
+			if p.Required {
+				params.Required = append(params.Required, p.Name)
+			}
+		}
+
+		var t ollamaTool
+		t.Type = "function"
+		t.Function.Name = tool.Name
+		t.Function.Description = tool.Description
+		t.Function.Parameters = params
+		ret = append(ret, t)
+	}
+	return ret
+}
+
+type ollamaChatResponse struct {
+	Message struct {
+		Content   string         `json:"content"`
+		Thinking  string         `json:"thinking"`
+		ToolCalls []chatToolCall `json:"tool_calls"`
+	} `json:"message"`
+	Done  bool   `json:"done"`
+	Error string `json:"error"`
+
+	// only set on the final chunk
+	Stats
+}
+
+// Ollama talks to an ollama server through its /api/chat endpoint.
+type Ollama struct {
+	endpoint Endpoint
+}
+
+// endpoint.URL is the base url of the server e.g. http://localhost:11434
+func NewOllama(endpoint Endpoint) *Ollama {
+	if endpoint.URL == "" {
+		endpoint.URL = OLLAMA_URL
+	}
+	return &Ollama{
+		endpoint: endpoint,
+	}
+}
+
+func (o *Ollama) Ping() error {
+	return o.endpoint.ping("/api/version")
+}
+
+func (o *Ollama) SupportsTools() bool {
+	return true
+}
+
+func (o *Ollama) Chat(
+	ctx context.Context,
+	req ChatRequest,
+) (<-chan Event, error) {
+	requestJson, err := json.Marshal(ollamaChatRequest{
+		Model:    req.Model,
+		Messages: toChatMessages(req.Messages),
+		Tools:    toOllamaTools(req.Tools),
+		Stream:   true,
+		Options:  req.Options,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := o.endpoint.newRequest(
+		ctx,
+		http.MethodPost,
+		"/api/chat",
+		bytes.NewReader(requestJson),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.endpoint.do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf(
+			"%w: %s is not installed on %s",
+			ErrModelNotFound,
+			req.Model,
+			o.endpoint.URL,
+		)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, statusError(resp)
+	}
+
+	log.Println("got a response", resp)
+
+	ch := make(chan Event)
+	start := time.Now()
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(ch)
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+
+			var partialResponse ollamaChatResponse
+			err := json.Unmarshal(line, &partialResponse)
+			if err != nil {
+				send(ctx, ch, Error{fmt.Errorf("Failed to decode response: %w", err)})
+				return
+			}
+
+			if partialResponse.Error != "" {
+				send(ctx, ch, Error{errors.New(partialResponse.Error)})
+				return
+			}
+
+			if thinking := partialResponse.Message.Thinking; thinking != "" {
+				if !send(ctx, ch, Thinking{thinking}) {
+					return
+				}
+			}
+
+			if resp := partialResponse.Message.Content; resp != "" {
+				log.Println("partial response:", resp)
+				if !send(ctx, ch, Token{resp}) {
+					return
+				}
+			}
+
+			if calls := partialResponse.Message.ToolCalls; len(calls) > 0 {
+				ev := ToolCalls{}
+				for _, call := range calls {
+					ev.Calls = append(ev.Calls, call.Function)
+				}
+				if !send(ctx, ch, ev) {
+					return
+				}
+			}
+
+			if partialResponse.Done {
+				stats := partialResponse.Stats
+				stats.Duration = time.Since(start)
+				send(ctx, ch, Done{Stats: stats})
+				return
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		if err := scanner.Err(); err != nil {
+			send(ctx, ch, Error{fmt.Errorf("Failed to read response: %w", err)})
+			return
+		}
+		send(ctx, ch, Error{errIncompleteResponse})
+	}()
+
+	return ch, nil
+}
+
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name       string    `json:"name"`
+		Size       int64     `json:"size"`
+		ModifiedAt time.Time `json:"modified_at"`
+	} `json:"models"`
+}
+
+func (o *Ollama) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var tags ollamaTagsResponse
+	err := o.endpoint.sendJSON(ctx, http.MethodGet, "/api/tags", nil, &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]ModelInfo, len(tags.Models))
+	for i, m := range tags.Models {
+		models[i] = ModelInfo{
+			Name:       m.Name,
+			Size:       m.Size,
+			ModifiedAt: m.ModifiedAt,
+		}
+	}
+	return models, nil
+}
+
+type ollamaShowResponse struct {
+	Details struct {
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+
+	// keys are prefixed with the model's architecture
+	// e.g. llama.context_length
+	ModelInfo map[string]any `json:"model_info"`
+}
+
+func (o *Ollama) ShowModel(ctx context.Context, name string) (ModelDetails, error) {
+	var show ollamaShowResponse
+	err := o.endpoint.sendJSON(
+		ctx,
+		http.MethodPost,
+		"/api/show",
+		map[string]string{"model": name},
+		&show,
+	)
+	if err != nil {
+		if errors.Is(err, ErrServerUnreachable) {
+			return ModelDetails{}, err
+		}
+		var notFound *statusCodeError
+		if errors.As(err, &notFound) && notFound.code == http.StatusNotFound {
+			return ModelDetails{}, fmt.Errorf(
+				"%w: %s is not installed on %s",
+				ErrModelNotFound,
+				name,
+				o.endpoint.URL,
+			)
+		}
+		return ModelDetails{}, err
+	}
+
+	details := ModelDetails{
+		Name:          name,
+		Family:        show.Details.Family,
+		ParameterSize: show.Details.ParameterSize,
+		Quantization:  show.Details.QuantizationLevel,
+	}
+	for k, v := range show.ModelInfo {
+		if n, ok := v.(float64); ok && strings.HasSuffix(k, ".context_length") {
+			details.ContextLength = int(n)
+		}
+	}
+	return details, nil
+}
+
+type ollamaPullResponse struct {
+	Status    string `json:"status"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+func (o *Ollama) PullModel(
+	ctx context.Context,
+	name string,
+) (<-chan PullProgress, error) {
+	requestJson, err := json.Marshal(map[string]any{
+		"model":  name,
+		"stream": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := o.endpoint.newRequest(
+		ctx,
+		http.MethodPost,
+		"/api/pull",
+		bytes.NewReader(requestJson),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.endpoint.do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, statusError(resp)
+	}
+
+	ch := make(chan PullProgress)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(ch)
+
+		sendProgress := func(p PullProgress) bool {
+			select {
+			case ch <- p:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+
+			var progress ollamaPullResponse
+			if err := json.Unmarshal(line, &progress); err != nil {
+				sendProgress(PullProgress{
+					Err: fmt.Errorf("Failed to decode pull progress: %w", err),
+				})
+				return
+			}
+			if progress.Error != "" {
+				sendProgress(PullProgress{Err: errors.New(progress.Error)})
+				return
+			}
+
+			ok := sendProgress(PullProgress{
+				Status:    progress.Status,
+				Total:     progress.Total,
+				Completed: progress.Completed,
+			})
+			if !ok || progress.Status == "success" {
+				return
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		err := scanner.Err()
+		if err == nil {
+			err = errIncompleteResponse
+		}
+		sendProgress(PullProgress{Err: err})
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,225 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	OPENAI_URL = "http://localhost:8080/v1"
+)
+
+type openAIChatRequest struct {
+	Model         string        `json:"model"`
+	Messages      []chatMessage `json:"messages"`
+	Stream        bool          `json:"stream"`
+	StreamOptions struct {
+		// asks for a final chunk with the token counts
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+
+	// not part of OpenAI's api but llama.cpp and vLLM accept them
+	TopK          *int     `json:"top_k,omitempty"`
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"`
+}
+
+type openAIChatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+
+			// llama.cpp and vLLM send a reasoning model's thoughts here
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// OpenAI talks to any server that implements OpenAI's chat completions
+// api such as llama.cpp's server, vLLM or LM Studio.
+type OpenAI struct {
+	endpoint Endpoint
+}
+
+// endpoint.URL is the base url of the api including the version
+// e.g. http://localhost:8080/v1. endpoint.Token is used as the api key.
+func NewOpenAI(endpoint Endpoint) *OpenAI {
+	if endpoint.URL == "" {
+		endpoint.URL = OPENAI_URL
+	}
+	return &OpenAI{
+		endpoint: endpoint,
+	}
+}
+
+func (o *OpenAI) Ping() error {
+	return o.endpoint.ping("/models")
+}
+
+func (o *OpenAI) Chat(
+	ctx context.Context,
+	req ChatRequest,
+) (<-chan Event, error) {
+	// num_ctx is ignored because the context length is decided when the
+	// server is started
+	request := openAIChatRequest{
+		Model:         req.Model,
+		Messages:      toChatMessages(req.Messages),
+		Stream:        true,
+		Temperature:   req.Options.Temperature,
+		TopP:          req.Options.TopP,
+		Seed:          req.Options.Seed,
+		Stop:          req.Options.Stop,
+		TopK:          req.Options.TopK,
+		RepeatPenalty: req.Options.RepeatPenalty,
+	}
+	request.StreamOptions.IncludeUsage = true
+
+	requestJson, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := o.endpoint.newRequest(
+		ctx,
+		http.MethodPost,
+		"/chat/completions",
+		bytes.NewReader(requestJson),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.endpoint.do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf(
+			"%w: %s is not served by %s",
+			ErrModelNotFound,
+			req.Model,
+			o.endpoint.URL,
+		)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf(
+			"chat completion for %s failed: %w",
+			req.Model,
+			statusError(resp),
+		)
+	}
+
+	ch := make(chan Event)
+	start := time.Now()
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(ch)
+
+		// the response is a stream of server sent events
+		// each one being "data: <json>" with "data: [DONE]" at the end
+		var stats Stats
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue
+			}
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				stats.Duration = time.Since(start)
+				send(ctx, ch, Done{Stats: stats})
+				return
+			}
+
+			var chunk openAIChatChunk
+			err := json.Unmarshal([]byte(data), &chunk)
+			if err != nil {
+				send(ctx, ch, Error{fmt.Errorf("Failed to decode response: %w", err)})
+				return
+			}
+			if chunk.Error != nil {
+				send(ctx, ch, Error{errors.New(chunk.Error.Message)})
+				return
+			}
+			if usage := chunk.Usage; usage != nil {
+				stats.PromptEvalCount = usage.PromptTokens
+				stats.EvalCount = usage.CompletionTokens
+			}
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+
+			delta := chunk.Choices[0].Delta
+			if thinking := delta.ReasoningContent; thinking != "" {
+				if !send(ctx, ch, Thinking{thinking}) {
+					return
+				}
+			}
+			if content := delta.Content; content != "" {
+				if !send(ctx, ch, Token{content}) {
+					return
+				}
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		if err := scanner.Err(); err != nil {
+			send(ctx, ch, Error{fmt.Errorf("Failed to read response: %w", err)})
+			return
+		}
+		send(ctx, ch, Error{errIncompleteResponse})
+	}()
+
+	return ch, nil
+}
+
+type openAIModelsResponse struct {
+	Data []struct {
+		ID      string `json:"id"`
+		Created int64  `json:"created"`
+	} `json:"data"`
+}
+
+func (o *OpenAI) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var list openAIModelsResponse
+	err := o.endpoint.sendJSON(ctx, http.MethodGet, "/models", nil, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]ModelInfo, len(list.Data))
+	for i, m := range list.Data {
+		models[i] = ModelInfo{Name: m.ID}
+		if m.Created > 0 {
+			models[i].ModifiedAt = time.Unix(m.Created, 0)
+		}
+	}
+	return models, nil
+}
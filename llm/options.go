@@ -0,0 +1,182 @@
+package llm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Options control how the model generates its answer. Fields that are
+// nil are left to the server's defaults.
+type Options struct {
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"top_p,omitempty"`
+	TopK          *int     `json:"top_k,omitempty"`
+	NumCtx        *int     `json:"num_ctx,omitempty"`
+	Seed          *int     `json:"seed,omitempty"`
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"`
+	Stop          []string `json:"stop,omitempty"`
+}
+
+// OptionNames are the names accepted by Options.Set and Options.Unset.
+// They're the same as the names ollama uses.
+var OptionNames = []string{
+	"temperature",
+	"top_p",
+	"top_k",
+	"num_ctx",
+	"seed",
+	"repeat_penalty",
+	"stop",
+}
+
+// Set parses value and sets the option called name. stop takes a comma
+// separated list of stop sequences.
+func (o *Options) Set(name, value string) error {
+	var err error
+	value = strings.TrimSpace(value)
+
+	switch name {
+	case "temperature":
+		o.Temperature, err = parseFloat(value, 0)
+	case "top_p":
+		o.TopP, err = parseFloat(value, 0)
+	case "top_k":
+		o.TopK, err = parseInt(value, 0)
+	case "num_ctx":
+		o.NumCtx, err = parseInt(value, 1)
+	case "seed":
+		o.Seed, err = parseInt(value, math.MinInt)
+	case "repeat_penalty":
+		o.RepeatPenalty, err = parseFloat(value, 0)
+	case "stop":
+		o.Stop = nil
+		for _, stop := range strings.Split(value, ",") {
+			if stop = strings.TrimSpace(stop); stop != "" {
+				o.Stop = append(o.Stop, stop)
+			}
+		}
+	default:
+		return invalidOptionError(name)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Invalid value for %s: %w", name, err)
+	}
+	return nil
+}
+
+// Unset resets the option called name to the server's default.
+func (o *Options) Unset(name string) error {
+	switch name {
+	case "temperature":
+		o.Temperature = nil
+	case "top_p":
+		o.TopP = nil
+	case "top_k":
+		o.TopK = nil
+	case "num_ctx":
+		o.NumCtx = nil
+	case "seed":
+		o.Seed = nil
+	case "repeat_penalty":
+		o.RepeatPenalty = nil
+	case "stop":
+		o.Stop = nil
+	default:
+		return invalidOptionError(name)
+	}
+	return nil
+}
+
+// Merge sets every option that is set in other.
+func (o *Options) Merge(other Options) {
+	if other.Temperature != nil {
+		o.Temperature = other.Temperature
+	}
+	if other.TopP != nil {
+		o.TopP = other.TopP
+	}
+	if other.TopK != nil {
+		o.TopK = other.TopK
+	}
+	if other.NumCtx != nil {
+		o.NumCtx = other.NumCtx
+	}
+	if other.Seed != nil {
+		o.Seed = other.Seed
+	}
+	if other.RepeatPenalty != nil {
+		o.RepeatPenalty = other.RepeatPenalty
+	}
+	if other.Stop != nil {
+		o.Stop = other.Stop
+	}
+}
+
+// String returns the options that are set as name=value pairs.
+func (o Options) String() string {
+	var parts []string
+	add := func(name string, value string) {
+		parts = append(parts, name+"="+value)
+	}
+
+	if o.Temperature != nil {
+		add("temperature", formatFloat(*o.Temperature))
+	}
+	if o.TopP != nil {
+		add("top_p", formatFloat(*o.TopP))
+	}
+	if o.TopK != nil {
+		add("top_k", strconv.Itoa(*o.TopK))
+	}
+	if o.NumCtx != nil {
+		add("num_ctx", strconv.Itoa(*o.NumCtx))
+	}
+	if o.Seed != nil {
+		add("seed", strconv.Itoa(*o.Seed))
+	}
+	if o.RepeatPenalty != nil {
+		add("repeat_penalty", formatFloat(*o.RepeatPenalty))
+	}
+	if o.Stop != nil {
+		add("stop", fmt.Sprintf("%q", o.Stop))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func invalidOptionError(name string) error {
+	return fmt.Errorf(
+		"Invalid option %q. acceptable options are: %s",
+		name,
+		strings.Join(OptionNames, ", "),
+	)
+}
+
+func parseFloat(s string, min float64) (*float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	if f < min {
+		return nil, fmt.Errorf("%s must be at least %s", s, formatFloat(min))
+	}
+	return &f, nil
+}
+
+func parseInt(s string, min int) (*int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, err
+	}
+	if i < min {
+		return nil, fmt.Errorf("%s must be at least %d", s, min)
+	}
+	return &i, nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestOptionsSet(t *testing.T) {
+	tests := []struct {
+		sets     [][2]string
+		expected string
+	}{
+		{nil, ""},
+		{[][2]string{{"temperature", "0.7"}}, "temperature=0.7"},
+		{
+			[][2]string{{"num_ctx", "8192"}, {"seed", "42"}, {"top_k", "40"}},
+			"top_k=40 num_ctx=8192 seed=42",
+		},
+		{
+			[][2]string{{"stop", "</answer>, User:"}},
+			`stop=["</answer>" "User:"]`,
+		},
+		{
+			[][2]string{{"temperature", "1"}, {"temperature", "0.2"}},
+			"temperature=0.2",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			var o Options
+			for _, set := range tt.sets {
+				if err := o.Set(set[0], set[1]); err != nil {
+					t.Fatalf("Failed to set %s=%s: %v", set[0], set[1], err)
+				}
+			}
+			if s := o.String(); s != tt.expected {
+				t.Errorf("bad options. got=%q. expected=%q", s, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOptionsSetInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"temperature", "hot"},
+		{"temperature", "-1"},
+		{"num_ctx", "0"},
+		{"top_k", "1.5"},
+		{"mirostat", "1"},
+	}
+
+	for _, tt := range tests {
+		var o Options
+		if err := o.Set(tt.name, tt.value); err == nil {
+			t.Errorf("expected setting %s=%s to fail", tt.name, tt.value)
+		}
+	}
+}
+
+func TestOptionsUnsetAndMerge(t *testing.T) {
+	var o Options
+	_ = o.Set("temperature", "0.5")
+	_ = o.Set("seed", "1")
+
+	var other Options
+	_ = other.Set("seed", "2")
+	_ = other.Set("num_ctx", "2048")
+	o.Merge(other)
+
+	if s := o.String(); s != "temperature=0.5 num_ctx=2048 seed=2" {
+		t.Errorf("bad merged options. got=%q", s)
+	}
+
+	if err := o.Unset("temperature"); err != nil {
+		t.Fatalf("Unset failed: %v", err)
+	}
+	if s := o.String(); s != "num_ctx=2048 seed=2" {
+		t.Errorf("bad options after unset. got=%q", s)
+	}
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"num_ctx":2048,"seed":2}` {
+		t.Errorf("unset options should be omitted. got=%s", b)
+	}
+}
@@ -0,0 +1,13 @@
+package llm
+
+// Persona is a reusable setup for a session, e.g. a code reviewer or a
+// paper summarizer.
+type Persona struct {
+	Name         string `json:"name"`
+	SystemPrompt string `json:"system_prompt"`
+
+	// empty means the session's current model is kept
+	Model string `json:"model,omitempty"`
+
+	Options Options `json:"options"`
+}
@@ -0,0 +1,308 @@
+package llm
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/Hassan-Ibrahim-1/research/command"
+)
+
+const (
+	// shorter quotes are usually names or terms rather than quotations
+	minQuoteWords = 4
+
+	// how similar a passage has to be for a quote to count as a close match,
+	// from 0 to 1
+	fuzzyQuoteThreshold = 0.8
+
+	// how many passages of a source are compared word by word with a quote
+	// that isn't in it, see closestPassage
+	maxFuzzyPassages = 16
+)
+
+type QuoteStatus int
+
+const (
+	// the source doesn't contain the quote or anything close to it
+	QuoteUnverified QuoteStatus = iota
+
+	// the source contains the quote with small differences, see Quote.Match
+	QuoteFuzzy
+
+	// the source contains the quote word for word, ignoring case,
+	// punctuation and whitespace
+	QuoteExact
+)
+
+func (s QuoteStatus) String() string {
+	switch s {
+	case QuoteExact:
+		return "exact"
+	case QuoteFuzzy:
+		return "fuzzy"
+	default:
+		return "unverified"
+	}
+}
+
+// Quote is quoted text in an answer checked against the attachments.
+type Quote struct {
+	Text string `json:"text"`
+
+	// where the quote is in the answer, including the quotation marks
+	Loc command.Range `json:"loc"`
+
+	// the source the quote was found in or the one it's attributed to by a
+	// citation if it wasn't found. 0 if it wasn't found and isn't cited
+	SourceID int `json:"source_id,omitempty"`
+
+	Status QuoteStatus `json:"status"`
+
+	// the passage of the source that's closest to the quote, lowercased and
+	// without punctuation. only set for fuzzy matches
+	Match string `json:"match,omitempty"`
+}
+
+var quotePattern = regexp.MustCompile(`"([^"\n]+)"|“([^”\n]+)”`)
+
+// findQuotes returns the quotes in an answer that are long enough to be
+// quotations
+func findQuotes(answer string) []Quote {
+	var quotes []Quote
+	for _, m := range quotePattern.FindAllStringSubmatchIndex(answer, -1) {
+		start, end := m[2], m[3]
+		if start < 0 {
+			start, end = m[4], m[5]
+		}
+		text := answer[start:end]
+		if len(strings.Fields(text)) < minQuoteWords {
+			continue
+		}
+		quotes = append(quotes, Quote{
+			Text: text,
+			Loc:  command.Range{Start: m[0], End: m[1]},
+		})
+	}
+	return quotes
+}
+
+// verifyQuotes checks the quotes in answer against the contents of the
+// files and links attached to the messages before it. A quote followed by a
+// citation in the same sentence is only checked against the cited source,
+// other quotes against every attachment. Nothing is returned for answers
+// without attachments to check against, or for quotes that cite research
+// sources since their contents aren't kept. see Message.Quotes
+func verifyQuotes(answer string, before []Message) []Quote {
+	attachments := map[int]string{}
+	var order []int
+	for _, msg := range before {
+		if msg.Role != RoleUser {
+			continue
+		}
+		for _, a := range parseAttachments(msg.Content) {
+			if _, ok := attachments[a.ID]; !ok {
+				order = append(order, a.ID)
+			}
+			attachments[a.ID] = a.Content
+		}
+	}
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	citations := ParseCitations(answer)
+	var quotes []Quote
+	for _, q := range findQuotes(answer) {
+		candidates := order
+		id, cited := quoteCitation(answer, q, citations)
+		if cited {
+			if _, attached := attachments[id]; !attached {
+				continue
+			}
+			candidates = []int{id}
+			q.SourceID = id
+		}
+
+		best := 0.0
+		for _, id := range candidates {
+			status, match, score := matchQuote(q.Text, attachments[id])
+			if status > q.Status || (status == q.Status && score > best) {
+				q.Status, q.Match, q.SourceID, best = status, match, id, score
+			}
+			if status == QuoteExact {
+				break
+			}
+		}
+		if q.Status != QuoteFuzzy {
+			q.Match = ""
+		}
+		if q.Status == QuoteUnverified && !cited {
+			q.SourceID = 0
+		}
+		quotes = append(quotes, q)
+	}
+	return quotes
+}
+
+// quoteCitation returns the source cited right after the quote, before the
+// sentence ends
+func quoteCitation(answer string, q Quote, citations []Citation) (int, bool) {
+	for _, c := range citations {
+		if c.Loc.Start < q.Loc.End {
+			continue
+		}
+		if strings.ContainsAny(answer[q.Loc.End:c.Loc.Start], ".!?\n") {
+			return 0, false
+		}
+		return c.ID, true
+	}
+	return 0, false
+}
+
+// matchQuote looks for quote in content. Parts of a quote that are left out
+// with an ellipsis are matched separately and the worst match counts.
+func matchQuote(quote, content string) (status QuoteStatus, match string, score float64) {
+	contentWords := normalizeWords(content)
+	status, score = QuoteExact, 1
+
+	for _, part := range strings.FieldsFunc(quote, func(r rune) bool { return r == '…' }) {
+		for _, part := range strings.Split(part, "...") {
+			words := normalizeWords(part)
+			if len(words) == 0 {
+				continue
+			}
+			if containsWords(contentWords, words) {
+				continue
+			}
+
+			similar, passage := closestPassage(contentWords, words)
+			if similar < score {
+				score = similar
+				match = strings.Join(passage, " ")
+			}
+			if similar >= fuzzyQuoteThreshold {
+				status = min(status, QuoteFuzzy)
+			} else {
+				status = QuoteUnverified
+			}
+		}
+	}
+	return status, match, score
+}
+
+// normalizeWords returns the lowercase words of s without punctuation so
+// that quotes match regardless of formatting
+func normalizeWords(s string) []string {
+	s = strings.ReplaceAll(strings.ToLower(s), "’", "'")
+	var words []string
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	}) {
+		if w = strings.Trim(w, "'"); w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+func containsWords(words, sub []string) bool {
+	for i := 0; i+len(sub) <= len(words); i++ {
+		match := true
+		for j := range sub {
+			if words[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// closestPassage returns the run of words in content of the same length as
+// quote that's most similar to it, with its similarity.
+//
+// A passage can't be more similar than the share of the quote's words it
+// has, so those are counted for every passage first and only the
+// maxFuzzyPassages that have the most are compared word by word.
+func closestPassage(content, quote []string) (float64, []string) {
+	n := min(len(quote), len(content))
+	if n == 0 {
+		return 0, nil
+	}
+
+	type passage struct{ start, shared int }
+	passages := make([]passage, 0, len(content)-n+1)
+	want := map[string]int{}
+	for _, w := range quote {
+		want[w]++
+	}
+	have := map[string]int{}
+	shared := 0
+	for i, w := range content {
+		if have[w] < want[w] {
+			shared++
+		}
+		have[w]++
+		if i >= n {
+			old := content[i-n]
+			have[old]--
+			if have[old] < want[old] {
+				shared--
+			}
+		}
+		if i >= n-1 {
+			passages = append(passages, passage{i - n + 1, shared})
+		}
+	}
+	slices.SortStableFunc(passages, func(a, b passage) int {
+		return b.shared - a.shared
+	})
+
+	bound := func(p passage) float64 {
+		return float64(p.shared) / float64(len(quote))
+	}
+	best, bestStart := bound(passages[0]), passages[0].start
+	if best < fuzzyQuoteThreshold {
+		// not even the best passage could be a close match
+		return best, content[bestStart : bestStart+n]
+	}
+
+	best = -1
+	for _, p := range passages[:min(len(passages), maxFuzzyPassages)] {
+		if bound(p) <= best {
+			break
+		}
+		similar := 1 - float64(wordDistance(content[p.start:p.start+n], quote))/float64(len(quote))
+		if similar > best {
+			best, bestStart = similar, p.start
+		}
+	}
+	return max(0, best), content[bestStart : bestStart+n]
+}
+
+// wordDistance is the levenshtein distance between a and b counted in
+// words
+func wordDistance(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchQuote(t *testing.T) {
+	content := "The Go programming language is an open source project to make programmers more productive.\n" +
+		"Go is expressive, concise, clean, and efficient."
+
+	tests := []struct {
+		quote    string
+		expected QuoteStatus
+	}{
+		{"an open source project to make programmers more productive", QuoteExact},
+		{"GO IS EXPRESSIVE,   concise, clean", QuoteExact},
+		{"Go is expressive … clean, and efficient", QuoteExact},
+		{"an open source project to make developers more productive", QuoteFuzzy},
+		{"Go is expressive... a language for robots", QuoteUnverified},
+		{"Rust is a systems programming language", QuoteUnverified},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			status, _, _ := matchQuote(tt.quote, content)
+			if status != tt.expected {
+				t.Errorf("got=%s. expected=%s", status, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyQuotes(t *testing.T) {
+	var prompt bytes.Buffer
+	prompt.WriteString("what do they say?\n")
+	writeSource(&prompt, Source{ID: 1, Kind: SourceFile, Name: "a.md"}, []byte("The meeting was moved to Friday at noon."))
+	writeSource(&prompt, Source{ID: 2, Kind: SourceFile, Name: "b.md"}, []byte("Lunch will be provided for everyone attending."))
+
+	answer := `The notes say "the meeting was moved to Friday" [1] and "lunch will be provided for everyone" [1]. ` +
+		`Also "lunch will be provided for all" and "dinner is at seven tonight". "Too short".`
+
+	expected := []struct {
+		status   QuoteStatus
+		sourceID int
+	}{
+		{QuoteExact, 1},
+		{QuoteUnverified, 1},
+		{QuoteFuzzy, 2},
+		{QuoteUnverified, 0},
+	}
+
+	quotes := verifyQuotes(answer, []Message{NewMessage(RoleUser, prompt.String())})
+	if len(quotes) != len(expected) {
+		t.Fatalf("got %d quotes. expected %d: %+v", len(quotes), len(expected), quotes)
+	}
+	for i, q := range quotes {
+		if q.Status != expected[i].status || q.SourceID != expected[i].sourceID {
+			t.Errorf("%q: got=%s from %d. expected=%s from %d",
+				q.Text, q.Status, q.SourceID, expected[i].status, expected[i].sourceID)
+		}
+		if answer[q.Loc.Start] != '"' || answer[q.Loc.End-1] != '"' {
+			t.Errorf("bad location %s", q.Loc)
+		}
+	}
+
+	if quotes := verifyQuotes(answer, nil); quotes != nil {
+		t.Errorf("there's nothing to check the answer against. got=%+v", quotes)
+	}
+}
+
+func TestClosestPassage(t *testing.T) {
+	filler := strings.Repeat("the project was started by a few people at google ", 2000)
+	content := normalizeWords(filler + "Go is expressive, concise, clean, and efficient. " + filler)
+	quote := normalizeWords("Go is expressive, concise, tidy, and efficient")
+
+	similar, passage := closestPassage(content, quote)
+	if similar < fuzzyQuoteThreshold {
+		t.Errorf("expected a close match. got=%v", similar)
+	}
+	expected := "go is expressive concise clean and efficient"
+	if got := strings.Join(passage, " "); got != expected {
+		t.Errorf("got=%q. expected=%q", got, expected)
+	}
+}
+
+func TestQuotesSavedOnAnswer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.md")
+	if err := os.WriteFile(path, []byte("The meeting was moved to Friday at noon."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &fakeBackend{chunks: []string{`It "was moved to Friday at noon" [1].`}}
+	s := NewSession("test", backend)
+	ch, err := s.SendPrompt(context.Background(), fmt.Sprintf("when? @file(%s)", path))
+	if err != nil {
+		t.Fatalf("SendPrompt failed: %v", err)
+	}
+	for range ch {
+	}
+
+	messages := s.Messages()
+	quotes := messages[len(messages)-1].Quotes
+	if len(quotes) != 1 || quotes[0].Status != QuoteExact || quotes[0].SourceID != 1 {
+		t.Errorf("expected the quote to be checked. got=%+v", quotes)
+	}
+}
@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Hassan-Ibrahim-1/research/command"
+)
+
+// PromptCommand is a command like @file(main.go) that's replaced with
+// whatever Run returns before the prompt is sent. The arguments are checked
+// against the command's schema before Run is called so it only has to deal
+// with what the schema can't express.
+type PromptCommand struct {
+	Name    string
+	Aliases []string
+
+	// one line shown by /help
+	Help string
+
+	// what a positional argument is e.g. file. empty if the command doesn't
+	// take any
+	Arg string
+
+	// the fewest and most positional arguments. 0 MaxArgs means there's no
+	// limit
+	MinArgs int
+	MaxArgs int
+
+	// names of the keyword arguments the command takes
+	Keywords []string
+
+	// Check returns an error if the arguments' values are invalid. It
+	// mustn't read or fetch anything since it runs while the prompt is
+	// typed. optional
+	Check func(cmd command.Command) error
+
+	// Run returns what cmd is replaced with. ctx is cancelled when sending
+	// the prompt is
+	Run func(ctx context.Context, s *Session, cmd command.Command) ([]byte, error)
+}
+
+// Usage shows how the command is called e.g. @file(file, ..., lines=, max=)
+func (c PromptCommand) Usage() string {
+	var args []string
+	if c.Arg != "" {
+		args = append(args, c.Arg)
+		if c.MaxArgs != 1 {
+			args = append(args, "...")
+		}
+	}
+	for _, name := range c.Keywords {
+		args = append(args, name+"=")
+	}
+	return fmt.Sprintf("@%s(%s)", c.Name, strings.Join(args, ", "))
+}
+
+// check returns why cmd doesn't fit the command's schema
+func (c PromptCommand) check(cmd command.Command) error {
+	if err := checkKeywords(cmd, c.Keywords...); err != nil {
+		return err
+	}
+	n := len(cmd.Arguments)
+	switch {
+	case c.Arg == "" && n > 0:
+		return fmt.Errorf("@%s doesn't take arguments", cmd.Name)
+	case n < c.MinArgs && c.MinArgs == 1:
+		return fmt.Errorf("@%s needs a %s", cmd.Name, c.Arg)
+	case n < c.MinArgs:
+		return fmt.Errorf("@%s needs at least %d arguments", cmd.Name, c.MinArgs)
+	case c.MaxArgs > 0 && n > c.MaxArgs:
+		return fmt.Errorf("@%s takes at most %d arguments", cmd.Name, c.MaxArgs)
+	}
+	if c.Check != nil {
+		return c.Check(cmd)
+	}
+	return nil
+}
+
+var (
+	promptCommandsMu sync.Mutex
+
+	// in the order they were registered. the built in ones are in
+	// commands.go
+	promptCommands = builtinCommands()
+)
+
+// Register adds a prompt command that every session can run. It's meant
+// to be called before any prompt is sent, usually from an init function.
+func Register(c PromptCommand) error {
+	if c.Name == "" || c.Run == nil {
+		return errors.New("A prompt command needs a name and a Run function")
+	}
+
+	promptCommandsMu.Lock()
+	defer promptCommandsMu.Unlock()
+	for _, name := range append([]string{c.Name}, c.Aliases...) {
+		if _, ok := lookupCommandLocked(name); ok {
+			return fmt.Errorf("@%s is already a command", name)
+		}
+	}
+	promptCommands = append(promptCommands, c)
+	return nil
+}
+
+// PromptCommands returns every prompt command in the order they were
+// registered.
+func PromptCommands() []PromptCommand {
+	promptCommandsMu.Lock()
+	defer promptCommandsMu.Unlock()
+	return slices.Clone(promptCommands)
+}
+
+// lookupCommand returns the command with name or alias name
+func lookupCommand(name string) (PromptCommand, bool) {
+	promptCommandsMu.Lock()
+	defer promptCommandsMu.Unlock()
+	return lookupCommandLocked(name)
+}
+
+// promptCommandsMu must be held
+func lookupCommandLocked(name string) (PromptCommand, bool) {
+	for _, c := range promptCommands {
+		if c.Name == name || slices.Contains(c.Aliases, name) {
+			return c, true
+		}
+	}
+	return PromptCommand{}, false
+}
+
+// commandNames returns the names and aliases of every command
+func commandNames() []string {
+	var names []string
+	for _, c := range PromptCommands() {
+		names = append(names, c.Name)
+		names = append(names, c.Aliases...)
+	}
+	return names
+}
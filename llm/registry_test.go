@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Hassan-Ibrahim-1/research/command"
+)
+
+func TestRegister(t *testing.T) {
+	registered := PromptCommands()
+	t.Cleanup(func() { promptCommands = registered })
+
+	shout := PromptCommand{
+		Name:    "shout",
+		Aliases: []string{"loud"},
+		Arg:     "text",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Run: func(ctx context.Context, s *Session, cmd command.Command) ([]byte, error) {
+			return []byte(strings.ToUpper(cmd.Arguments[0])), nil
+		},
+	}
+	if err := Register(shout); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	tests := []struct {
+		cmd PromptCommand
+		err string
+	}{
+		{PromptCommand{Name: "shout", Run: shout.Run}, "@shout is already a command"},
+		{PromptCommand{Name: "yell", Aliases: []string{"file"}, Run: shout.Run}, "@file is already a command"},
+		{PromptCommand{Name: "whisper"}, "A prompt command needs a name and a Run function"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			err := Register(tt.cmd)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("got=%v. expected=%q", err, tt.err)
+			}
+		})
+	}
+
+	s := NewSession("test", &fakeBackend{})
+	got, err := s.executePromptCommands(context.Background(), []byte("@shout(hi) and @loud(there)"))
+	if err != nil {
+		t.Fatalf("executePromptCommands failed: %v", err)
+	}
+	if string(got) != "HI and THERE" {
+		t.Errorf("got=%q. expected=%q", got, "HI and THERE")
+	}
+}
+
+func TestPromptCommandCheck(t *testing.T) {
+	pair := PromptCommand{Name: "pair", Arg: "word", MinArgs: 2, MaxArgs: 2, Keywords: []string{"sep"}}
+	none := PromptCommand{Name: "none"}
+
+	tests := []struct {
+		cmd   PromptCommand
+		input string
+		err   string
+	}{
+		{pair, "@pair(a, b, sep=-)", ""},
+		{pair, "@pair(a)", "@pair needs at least 2 arguments"},
+		{pair, "@pair(a, b, c)", "@pair takes at most 2 arguments"},
+		{pair, "@pair(a, b, by=-)", `Unknown argument "by" for @pair. acceptable arguments are: sep`},
+		{none, "@none()", ""},
+		{none, "@none(a)", "@none doesn't take arguments"},
+		{none, "@none(a=b)", "@none doesn't take keyword arguments"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			cmds, _ := command.Parse([]byte(tt.input))
+			if len(cmds) != 1 {
+				t.Fatalf("expected a command in %q", tt.input)
+			}
+			err := tt.cmd.check(cmds[0])
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("got=%v. expected=%q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tests := []struct {
+		cmd      PromptCommand
+		expected string
+	}{
+		{PromptCommand{Name: "none"}, "@none()"},
+		{PromptCommand{Name: "one", Arg: "file", MaxArgs: 1}, "@one(file)"},
+		{PromptCommand{Name: "file", Arg: "file", Keywords: []string{"lines", "max"}}, "@file(file, ..., lines=, max=)"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			if got := tt.cmd.Usage(); got != tt.expected {
+				t.Errorf("got=%q. expected=%q", got, tt.expected)
+			}
+		})
+	}
+}
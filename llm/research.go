@@ -0,0 +1,371 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Hassan-Ibrahim-1/research/command"
+)
+
+const (
+	// sources beyond this are dropped so a run doesn't take forever on a
+	// local model
+	maxResearchSources = 8
+
+	researchPlanPrompt = `You plan research. Break the user's question into at most 5 sub-questions that together answer it.
+Then list sources worth reading: local file paths and links mentioned in the question and links you are sure exist. Don't list the sources that are already attached.
+Reply with one item per line and nothing else, in this format:
+QUESTION: <sub-question>
+SOURCE: <file path or url>`
+
+	researchSourcePrompt = `You summarize sources for a research report. Summarize what the source says that helps answer the questions you are given.
+Keep facts, numbers and names, quote short passages word for word where the wording matters and say so if the source isn't relevant.`
+
+	researchReportPrompt = `You write research reports in markdown. Answer the user's question using the numbered summaries of the sources you are given.
+Cite the sources that support each claim with their numbers in square brackets, e.g. [1] or [2][3]. Only cite the given sources and say when something isn't covered by them.
+Don't list the sources at the end, that's done for you.`
+)
+
+// ResearchRun is everything that led to a research report. It's kept on the
+// report's message so the run can be looked at again once it's saved.
+type ResearchRun struct {
+	Questions []string `json:"questions,omitempty"`
+
+	// only the sources that could be read
+	Sources []Source `json:"sources,omitempty"`
+}
+
+type ResearchStage string
+
+const (
+	StagePlan      ResearchStage = "plan"
+	StageGather    ResearchStage = "gather"
+	StageSummarize ResearchStage = "summarize"
+	StageWrite     ResearchStage = "write"
+)
+
+// ResearchStep is sent by Session.Research as the run moves along. Detail
+// is the sub-question or source the step is about. Err is set when a
+// source couldn't be read or summarized, the run goes on without it.
+type ResearchStep struct {
+	Stage  ResearchStage
+	Detail string
+	Err    error
+}
+
+func (ResearchStep) event() {}
+
+// Research answers question with a report that cites its sources. The
+// question is split into sub-questions, the files and links attached with
+// @file and @link or suggested by the model are read and summarized and
+// then the report is written from the summaries. The report is streamed as
+// Tokens after a ResearchStep for each step.
+//
+// The question and report are added to the history like any other prompt,
+// with the run kept in the report's Message.Research.
+func (s *Session) Research(
+	ctx context.Context,
+	question string,
+) (<-chan Event, error) {
+	if strings.TrimSpace(question) == "" {
+		return nil, errors.New("There's nothing to research")
+	}
+	if diagnostics := Diagnose(question); len(diagnostics) > 0 {
+		return nil, diagnostics[0]
+	}
+
+	ch := make(chan Event)
+	sent := time.Now()
+
+	go func() {
+		defer close(ch)
+
+		run := &ResearchRun{}
+		report, last := s.research(ctx, ch, question, run)
+
+		q := NewMessage(RoleUser, question)
+		q.Time = sent
+		answer := NewMessage(RoleAssistant, report)
+		answer.Time = time.Now()
+		answer.Research = run
+		done, finished := last.(Done)
+		if finished {
+			answer.Stats = &done.Stats
+		} else {
+			answer.Interrupted = true
+		}
+		s.addMessages(q, answer)
+
+		if finished {
+			if compacted, ok := s.compact(ctx); ok {
+				send(ctx, ch, compacted)
+			}
+		}
+		if last != nil {
+			send(ctx, ch, last)
+		}
+	}()
+
+	return ch, nil
+}
+
+// research does every step of a run and returns the report and the Done or
+// Error it ended with. last is nil if ctx was cancelled
+func (s *Session) research(
+	ctx context.Context,
+	ch chan<- Event,
+	question string,
+	run *ResearchRun,
+) (report string, last Event) {
+	if !send(ctx, ch, ResearchStep{Stage: StagePlan}) {
+		return "", nil
+	}
+	attached := attachedSources([]byte(question))
+	plan, err := s.complete(ctx, []Message{
+		NewMessage(RoleSystem, researchPlanPrompt),
+		NewMessage(RoleUser, planRequest(question, attached)),
+	})
+	if err != nil {
+		return "", researchError(ctx, "Failed to plan the research", err)
+	}
+
+	questions, suggested := parsePlan(plan)
+	run.Questions = questions
+	for _, q := range questions {
+		if !send(ctx, ch, ResearchStep{Stage: StagePlan, Detail: q}) {
+			return "", nil
+		}
+	}
+
+	sources := mergeSources(attached, suggested)
+	for _, source := range sources {
+		if !send(ctx, ch, ResearchStep{Stage: StageGather, Detail: source.Name}) {
+			return "", nil
+		}
+
+		// sources the model came up with are only read once the user
+		// allows it, like the read_file and fetch_link tools
+		var err error
+		if !slices.Contains(attached, source) {
+			approved, ok := s.approve(ctx, ch, readCall(source))
+			if !ok {
+				return "", nil
+			}
+			if !approved {
+				err = errToolDenied
+			}
+		}
+
+		var content string
+		if err == nil {
+			content, err = readSource(ctx, source)
+		}
+		if err == nil {
+			if !send(ctx, ch, ResearchStep{Stage: StageSummarize, Detail: source.Name}) {
+				return "", nil
+			}
+			source.Summary, err = s.complete(ctx, []Message{
+				NewMessage(RoleSystem, researchSourcePrompt),
+				NewMessage(RoleUser, sourceRequest(questions, source, content)),
+			})
+		}
+		if ctx.Err() != nil {
+			return "", nil
+		}
+		if err != nil {
+			if !send(ctx, ch, ResearchStep{Stage: StageGather, Detail: source.Name, Err: err}) {
+				return "", nil
+			}
+			continue
+		}
+
+		// the same ids as attachments so citations mean the same thing in
+		// every answer
+		source.ID = s.addSource(source.Kind, source.Name).ID
+		run.Sources = append(run.Sources, source)
+	}
+
+	if !send(ctx, ch, ResearchStep{Stage: StageWrite}) {
+		return "", nil
+	}
+	response, err := s.backend.Chat(ctx, ChatRequest{
+		Model: s.Model(),
+		Messages: []Message{
+			NewMessage(RoleSystem, researchReportPrompt),
+			NewMessage(RoleUser, reportRequest(question, *run)),
+		},
+		Options: s.Options(),
+	})
+	if err != nil {
+		return "", researchError(ctx, "Failed to write the report", err)
+	}
+
+	var b strings.Builder
+	for ev := range response {
+		switch ev := ev.(type) {
+		case Token:
+			b.WriteString(ev.Content)
+		case Done, Error:
+			last = ev
+			continue
+		}
+		send(ctx, ch, ev)
+	}
+
+	if _, finished := last.(Done); finished && len(run.Sources) > 0 {
+		list := sourceList(run.Sources)
+		b.WriteString(list)
+		send(ctx, ch, Token{list})
+	}
+	return b.String(), last
+}
+
+func researchError(ctx context.Context, msg string, err error) Event {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return Error{fmt.Errorf("%s: %w", msg, err)}
+}
+
+// attachedSources returns the files and links attached to prompt with
+// commands
+func attachedSources(prompt []byte) []Source {
+	var sources []Source
+	cmds, _ := command.Parse(prompt)
+	for _, cmd := range cmds {
+		c, _ := lookupCommand(cmd.Name)
+		var kind SourceKind
+		switch c.Name {
+		case "file":
+			kind = SourceFile
+		case "link":
+			kind = SourceLink
+		default:
+			continue
+		}
+		for _, arg := range cmd.Arguments {
+			sources = append(sources, Source{Kind: kind, Name: arg})
+		}
+	}
+	return sources
+}
+
+// parsePlan reads the QUESTION: and SOURCE: lines of the model's plan.
+// anything else is ignored since models like to add an introduction
+func parsePlan(plan string) (questions []string, sources []Source) {
+	for _, line := range strings.Split(plan, "\n") {
+		line = strings.TrimLeft(strings.TrimSpace(line), "-*0123456789. ")
+
+		key, value, ok := strings.Cut(line, ":")
+		value = strings.Trim(value, " *`<>")
+		if !ok || value == "" {
+			continue
+		}
+
+		switch strings.ToUpper(strings.Trim(key, "*")) {
+		case "QUESTION":
+			questions = append(questions, value)
+		case "SOURCE":
+			kind := SourceFile
+			if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+				kind = SourceLink
+			}
+			sources = append(sources, Source{Kind: kind, Name: value})
+		}
+	}
+	return questions, sources
+}
+
+// mergeSources returns the attached sources followed by the suggested ones
+// without duplicates, up to maxResearchSources
+func mergeSources(attached, suggested []Source) []Source {
+	var sources []Source
+	seen := map[string]bool{}
+	for _, source := range slices.Concat(attached, suggested) {
+		if seen[source.Name] || len(sources) == maxResearchSources {
+			continue
+		}
+		seen[source.Name] = true
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// readCall is the tool call that would read source, used to ask the user
+// before reading a source the model suggested
+func readCall(source Source) ToolCall {
+	if source.Kind == SourceLink {
+		return ToolCall{Name: "fetch_link", Arguments: map[string]any{"url": source.Name}}
+	}
+	return ToolCall{Name: "read_file", Arguments: map[string]any{"path": source.Name}}
+}
+
+// readSource returns the source's contents the same way @file and @link
+// embed them
+func readSource(ctx context.Context, source Source) (string, error) {
+	b, err := fetchSource(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	if len(b) > maxToolOutput {
+		b = append(b[:runeCut(b, maxToolOutput)], "\n(the rest was cut off)"...)
+	}
+	var w bytes.Buffer
+	writeSource(&w, source, b)
+	return w.String(), nil
+}
+
+func planRequest(question string, attached []Source) string {
+	b := strings.Builder{}
+	b.WriteString(question)
+	if len(attached) > 0 {
+		b.WriteString("\n\nAttached sources:\n")
+		for _, source := range attached {
+			fmt.Fprintf(&b, "- %s\n", source.Name)
+		}
+	}
+	return b.String()
+}
+
+func sourceRequest(questions []string, source Source, content string) string {
+	b := strings.Builder{}
+	b.WriteString("Questions:\n")
+	for _, q := range questions {
+		fmt.Fprintf(&b, "- %s\n", q)
+	}
+	fmt.Fprintf(&b, "\nSource %s:\n%s", source.Name, content)
+	return b.String()
+}
+
+func reportRequest(question string, run ResearchRun) string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "Question: %s\n", question)
+	if len(run.Questions) > 0 {
+		b.WriteString("\nSub-questions:\n")
+		for _, q := range run.Questions {
+			fmt.Fprintf(&b, "- %s\n", q)
+		}
+	}
+	if len(run.Sources) == 0 {
+		b.WriteString("\nNo sources could be read.\n")
+	}
+	for _, source := range run.Sources {
+		fmt.Fprintf(&b, "\n[%d] %s\n%s\n", source.ID, source.Name, source.Summary)
+	}
+	return b.String()
+}
+
+// sourceList is appended to the report so the citations can be looked up
+func sourceList(sources []Source) string {
+	b := strings.Builder{}
+	b.WriteString("\n\n## Sources\n\n")
+	for _, source := range sources {
+		fmt.Fprintf(&b, "- [%d] %s\n", source.ID, source.Name)
+	}
+	return b.String()
+}
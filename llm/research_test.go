@@ -0,0 +1,258 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePlan(t *testing.T) {
+	tests := []struct {
+		input     string
+		questions []string
+		sources   []Source
+	}{
+		{"", nil, nil},
+		{
+			"QUESTION: what is go?\nSOURCE: https://go.dev\nSOURCE: notes.md",
+			[]string{"what is go?"},
+			[]Source{{Kind: SourceLink, Name: "https://go.dev"}, {Kind: SourceFile, Name: "notes.md"}},
+		},
+		{
+			"Here is the plan:\n\n1. Question: who?\n- **SOURCE:** <https://a.com/x?y=1>\nSOURCE:",
+			[]string{"who?"},
+			[]Source{{Kind: SourceLink, Name: "https://a.com/x?y=1"}},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			questions, sources := parsePlan(tt.input)
+			if !reflect.DeepEqual(questions, tt.questions) {
+				t.Errorf("got=%q. expected=%q", questions, tt.questions)
+			}
+			if !reflect.DeepEqual(sources, tt.sources) {
+				t.Errorf("got=%+v. expected=%+v", sources, tt.sources)
+			}
+		})
+	}
+}
+
+func TestMergeSources(t *testing.T) {
+	attached := attachedSources([]byte("compare @file(a.md) with @link(https://b.com) and c.md"))
+	suggested := []Source{
+		{Kind: SourceLink, Name: "https://b.com"},
+		{Kind: SourceFile, Name: "c.md"},
+		{Kind: SourceFile, Name: "/etc/passwd"},
+		{Kind: SourceLink, Name: "https://d.com"},
+	}
+
+	var names []string
+	for _, source := range mergeSources(attached, suggested) {
+		names = append(names, source.Name)
+	}
+	expected := []string{"a.md", "https://b.com", "c.md", "/etc/passwd", "https://d.com"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("got=%q. expected=%q", names, expected)
+	}
+}
+
+// researchBackend answers each step of a research run by its system prompt.
+// report is set to the last report request
+func researchBackend(plan string, report *string) *fakeBackend {
+	return &fakeBackend{reply: func(n int, req ChatRequest) fakeReply {
+		var content string
+		switch req.Messages[0].Content {
+		case researchPlanPrompt:
+			content = plan
+		case researchSourcePrompt:
+			content = "the meeting is on friday"
+		case researchReportPrompt:
+			*report = req.Messages[1].Content
+			content = "It's on friday [1]."
+		}
+		return fakeReply{chunks: []string{content}}
+	}}
+}
+
+func TestResearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.md")
+	if err := os.WriteFile(path, []byte("meeting: friday"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var request string
+	s := NewSession("test", researchBackend("QUESTION: when is the meeting?\nSOURCE: missing.md", &request))
+
+	question := fmt.Sprintf("when is the meeting? @file(%s) missing.md", path)
+	ch, err := s.Research(context.Background(), question)
+	if err != nil {
+		t.Fatalf("Research failed: %v", err)
+	}
+
+	var (
+		steps  []string
+		report strings.Builder
+		last   Event
+	)
+	for ev := range ch {
+		switch ev := ev.(type) {
+		case ResearchStep:
+			step := string(ev.Stage)
+			if ev.Err != nil {
+				step += " failed"
+			}
+			steps = append(steps, step)
+		case ToolRequested:
+			ev.Approve <- true
+		case Token:
+			report.WriteString(ev.Content)
+		}
+		last = ev
+	}
+
+	if _, ok := last.(Done); !ok {
+		t.Fatalf("expected the run to end with Done. got=%+v", last)
+	}
+	expected := "plan plan gather summarize gather gather failed write"
+	if got := strings.Join(steps, " "); got != expected {
+		t.Errorf("got=%q. expected=%q", got, expected)
+	}
+	if !strings.Contains(request, "[1] "+path+"\nthe meeting is on friday") {
+		t.Errorf("the report should get the numbered summaries. got=%q", request)
+	}
+
+	messages := s.Messages()
+	if len(messages) != 2 || messages[0].Content != question {
+		t.Fatalf("expected the question and report in the history. got=%+v", messages)
+	}
+	answer := messages[1]
+	if answer.Content != report.String() || !strings.HasSuffix(answer.Content, "- [1] "+path+"\n") {
+		t.Errorf("bad report. got=%q", answer.Content)
+	}
+	run := ResearchRun{
+		Questions: []string{"when is the meeting?"},
+		Sources: []Source{
+			{ID: 1, Kind: SourceFile, Name: path, Summary: "the meeting is on friday"},
+		},
+	}
+	if !reflect.DeepEqual(answer.Research, &run) {
+		t.Errorf("got=%+v. expected=%+v", answer.Research, run)
+	}
+}
+
+func TestResearchSuggestedLink(t *testing.T) {
+	tests := []struct {
+		approve  bool
+		expected string
+	}{
+		{true, "plan plan gather summarize write"},
+		{false, "plan plan gather gather failed write"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			hits := 0
+			server := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					hits++
+					w.Write([]byte("meeting: friday"))
+				},
+			))
+			defer server.Close()
+
+			var request string
+			plan := "QUESTION: when is the meeting?\nSOURCE: " + server.URL
+			s := NewSession("test", researchBackend(plan, &request))
+
+			ch, err := s.Research(context.Background(), "when is the meeting?")
+			if err != nil {
+				t.Fatalf("Research failed: %v", err)
+			}
+
+			var steps []string
+			requested := false
+			for ev := range ch {
+				switch ev := ev.(type) {
+				case ToolRequested:
+					requested = true
+					if ev.Call.Arguments["url"] != server.URL {
+						t.Errorf("bad call. got=%s", ev.Call)
+					}
+					ev.Approve <- tt.approve
+				case ResearchStep:
+					step := string(ev.Stage)
+					if ev.Err != nil {
+						step += " failed"
+					}
+					steps = append(steps, step)
+				}
+			}
+
+			if !requested {
+				t.Fatalf("expected the link to need approval")
+			}
+			if got := strings.Join(steps, " "); got != tt.expected {
+				t.Errorf("got=%q. expected=%q", got, tt.expected)
+			}
+			expected := 0
+			if tt.approve {
+				expected = 1
+			}
+			if hits != expected {
+				t.Errorf("got=%d fetches. expected=%d", hits, expected)
+			}
+		})
+	}
+}
+
+func TestResearchSuggestedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.md")
+	if err := os.WriteFile(path, []byte("meeting: friday"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the path is in the question but isn't attached
+	var request string
+	s := NewSession("test", researchBackend("QUESTION: when is the meeting?\nSOURCE: "+path, &request))
+	ch, err := s.Research(context.Background(), "when is the meeting? it's not in "+path+".old")
+	if err != nil {
+		t.Fatalf("Research failed: %v", err)
+	}
+
+	var steps []string
+	requested := false
+	for ev := range ch {
+		switch ev := ev.(type) {
+		case ToolRequested:
+			requested = true
+			if ev.Call.Name != "read_file" || ev.Call.Arguments["path"] != path {
+				t.Errorf("bad call. got=%s", ev.Call)
+			}
+			ev.Approve <- false
+		case ResearchStep:
+			step := string(ev.Stage)
+			if ev.Err != nil {
+				step += " failed"
+			}
+			steps = append(steps, step)
+		}
+	}
+
+	if !requested {
+		t.Fatalf("expected the file to need approval")
+	}
+	expected := "plan plan gather gather failed write"
+	if got := strings.Join(steps, " "); got != expected {
+		t.Errorf("got=%q. expected=%q", got, expected)
+	}
+	if strings.Contains(request, "friday") {
+		t.Errorf("the file shouldn't have been read. got=%q", request)
+	}
+}
@@ -0,0 +1,173 @@
+package llm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// SnapshotVersion is the version of the format Snapshot is saved in. It's
+// increased whenever a change would stop older versions from reading it.
+//
+// 2 only saves Tree, version 1 files also have the current branch in
+// messages.
+const SnapshotVersion = 2
+
+// Snapshot is everything needed to resume a session later.
+type Snapshot struct {
+	Version int    `json:"version"`
+	ID      string `json:"id"`
+
+	// set by the user. see DisplayTitle
+	Title string `json:"title,omitempty"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+
+	Model        string  `json:"model"`
+	Options      Options `json:"options"`
+	SystemPrompt string  `json:"system_prompt,omitempty"`
+	Persona      string  `json:"persona,omitempty"`
+	TokenBudget  int     `json:"token_budget,omitempty"`
+
+	// the current branch. it isn't saved when there's a Tree and is
+	// followed from the tree's Node.Active when the snapshot is loaded
+	Messages []Message `json:"messages,omitempty"`
+
+	// every branch. older sessions only have Messages
+	Tree *Node `json:"tree,omitempty"`
+
+	// see Session.Sources
+	Sources []Source `json:"sources,omitempty"`
+}
+
+// savedSnapshot has the same fields as Snapshot without its json methods
+type savedSnapshot Snapshot
+
+func (snap Snapshot) MarshalJSON() ([]byte, error) {
+	saved := savedSnapshot(snap)
+	if saved.Tree != nil {
+		saved.Messages = nil
+	}
+	return json.Marshal(saved)
+}
+
+// UnmarshalJSON derives Messages from Tree when there is one so the two
+// can't disagree, even in version 1 files that have both
+func (snap *Snapshot) UnmarshalJSON(b []byte) error {
+	var saved savedSnapshot
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return err
+	}
+	*snap = Snapshot(saved)
+	if snap.Tree != nil {
+		snap.Messages = nil
+		for _, n := range followActive(snap.Tree) {
+			snap.Messages = append(snap.Messages, n.Message)
+		}
+	}
+	return nil
+}
+
+// newSessionID returns an id that sorts by creation time e.g.
+// 20240312-154501-9f2c
+func newSessionID(now time.Time) string {
+	b := make([]byte, 2)
+	_, _ = rand.Read(b)
+	return now.Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// DisplayTitle returns the title or the start of the first prompt if the
+// session wasn't given one.
+func (snap Snapshot) DisplayTitle() string {
+	if snap.Title != "" {
+		return snap.Title
+	}
+	for _, msg := range snap.Messages {
+		if msg.Role != RoleUser {
+			continue
+		}
+		prompt := msg.Raw
+		if prompt == "" {
+			prompt = msg.Content
+		}
+		prompt = strings.Join(strings.Fields(prompt), " ")
+		if r := []rune(prompt); len(r) > 50 {
+			prompt = string(r[:50]) + "…"
+		}
+		return prompt
+	}
+	return "untitled"
+}
+
+func (s *Session) Title() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.title
+}
+
+func (s *Session) SetTitle(title string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.title = title
+}
+
+// ID identifies the session when it's saved.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// Snapshot returns the session's current state. Updated is the time of the
+// last message.
+func (s *Session) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := Snapshot{
+		Version:      SnapshotVersion,
+		ID:           s.id,
+		Title:        s.title,
+		Created:      s.created,
+		Updated:      s.created,
+		Model:        s.model,
+		Options:      s.options,
+		SystemPrompt: s.systemPrompt,
+		Persona:      s.persona,
+		TokenBudget:  s.tokenBudget,
+		Messages:     s.history(),
+		Tree:         s.root.clone(),
+		Sources:      append([]Source(nil), s.sources...),
+	}
+	for _, msg := range snap.Messages {
+		if msg.Time.After(snap.Updated) {
+			snap.Updated = msg.Time
+		}
+	}
+	return snap
+}
+
+// Restore replaces the session's state with snap. The backend is kept.
+func (s *Session) Restore(snap Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.id = snap.ID
+	s.title = snap.Title
+	s.created = snap.Created
+	s.model = snap.Model
+	s.options = snap.Options
+	s.systemPrompt = snap.SystemPrompt
+	s.persona = snap.Persona
+	s.tokenBudget = snap.TokenBudget
+	if snap.Tree != nil {
+		s.root = *snap.Tree.clone()
+		s.path = followActive(&s.root)
+	} else {
+		s.setHistory(snap.Messages)
+	}
+	s.sources = append([]Source(nil), snap.Sources...)
+}
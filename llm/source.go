@@ -0,0 +1,307 @@
+package llm
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Hassan-Ibrahim-1/research/command"
+)
+
+const (
+	// added to prompts with attachments
+	citeInstruction = "\n\nThe attached sources have ids. Cite the sources that support each claim with their ids in square brackets, e.g. [1] or [1][2]. Quote them word for word in double quotes."
+
+	// footnote excerpts are cut off after this many runes
+	maxExcerpt = 300
+)
+
+type SourceKind string
+
+const (
+	SourceFile SourceKind = "file"
+	SourceLink SourceKind = "link"
+)
+
+// Source is a file or link that was attached to a prompt or read during a
+// research run.
+type Source struct {
+	// the number answers cite the source with e.g. [1]. it's the same for
+	// the whole session, see Session.Sources
+	ID int `json:"id"`
+
+	Kind SourceKind `json:"kind"`
+
+	// path of the file or url of the link
+	Name string `json:"name"`
+
+	// what the model took from the source. only set on research sources
+	Summary string `json:"summary,omitempty"`
+}
+
+// Sources returns every source that was attached or researched in the
+// session. A source's ID is its position in the list starting from 1.
+func (s *Session) Sources() []Source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Source(nil), s.sources...)
+}
+
+// addSource returns the source with kind and name, giving it the next id if
+// it hasn't been seen before
+func (s *Session) addSource(kind SourceKind, name string) Source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, source := range s.sources {
+		if source.Kind == kind && source.Name == name {
+			return source
+		}
+	}
+	source := Source{ID: len(s.sources) + 1, Kind: kind, Name: name}
+	s.sources = append(s.sources, source)
+	return source
+}
+
+// attachSource returns the source with kind and name like addSource, but a
+// new source is only pending until commitSources. prompts that fail to
+// expand or to be sent don't use up ids
+func (s *Session) attachSource(kind SourceKind, name string) Source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, source := range slices.Concat(s.sources, s.pending) {
+		if source.Kind == kind && source.Name == name {
+			return source
+		}
+	}
+	source := Source{ID: len(s.sources) + len(s.pending) + 1, Kind: kind, Name: name}
+	s.pending = append(s.pending, source)
+	return source
+}
+
+// commitSources adds the sources attached to the last expanded prompt to
+// Sources. s.mu must be held
+func (s *Session) commitSources() {
+	s.sources = append(s.sources, s.pending...)
+	s.pending = nil
+}
+
+// attachment is a source embedded in a prompt by writeSource
+type attachment struct {
+	Source
+	Content string
+}
+
+var attachmentTag = regexp.MustCompile(
+	`(?s)<(file|link) id="(\d+)" (?:name|url)=("(?:[^"\\]|\\.)*")>\n(.*?)\n</(?:file|link)>\n`,
+)
+
+// parseAttachments returns the sources with ids embedded in prompt
+func parseAttachments(prompt string) []attachment {
+	var attachments []attachment
+	for _, m := range attachmentTag.FindAllStringSubmatch(prompt, -1) {
+		id, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		name, err := strconv.Unquote(m[3])
+		if err != nil {
+			continue
+		}
+		attachments = append(attachments, attachment{
+			Source:  Source{ID: id, Kind: SourceKind(m[1]), Name: name},
+			Content: m[4],
+		})
+	}
+	return attachments
+}
+
+// Citation is a marker like [2] in an answer that refers to a source.
+// [1, 2] and [1][2] are a citation per source.
+type Citation struct {
+	ID int
+
+	// where the marker is in the answer
+	Loc command.Range
+}
+
+// ParseCitations returns the citations in an answer in the order they
+// appear. Markdown links like [1](url) and anything in code isn't a
+// citation.
+func ParseCitations(answer string) []Citation {
+	var (
+		citations []Citation
+		inCode    bool
+	)
+	for i := 0; i < len(answer); i++ {
+		switch answer[i] {
+		case '`':
+			inCode = !inCode
+			continue
+		case '[':
+		default:
+			continue
+		}
+		if inCode {
+			continue
+		}
+
+		end := strings.IndexByte(answer[i:], ']')
+		if end < 0 {
+			break
+		}
+		end += i
+		if end+1 < len(answer) && answer[end+1] == '(' {
+			continue
+		}
+
+		var ids []int
+		for _, field := range strings.Split(answer[i+1:end], ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || id <= 0 {
+				ids = nil
+				break
+			}
+			ids = append(ids, id)
+		}
+		for _, id := range ids {
+			citations = append(citations, Citation{id, command.Range{Start: i, End: end + 1}})
+		}
+		if len(ids) > 0 {
+			i = end
+		}
+	}
+	return citations
+}
+
+// Footnote is a source cited by an answer.
+type Footnote struct {
+	Source Source
+
+	// the part of the source that best matches the sentence citing it. the
+	// summary for research sources since their contents aren't kept
+	Excerpt string
+}
+
+// Footnotes returns the sources cited by the message at index in the order
+// they're first cited. Citations of sources the session doesn't have are
+// left out.
+func (s *Session) Footnotes(index int) []Footnote {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := s.history()
+	if index < 0 || index >= len(messages) {
+		return nil
+	}
+	answer := messages[index].Content
+
+	var (
+		footnotes []Footnote
+		seen      = map[int]bool{}
+	)
+	for _, c := range ParseCitations(answer) {
+		if seen[c.ID] || c.ID > len(s.sources) {
+			continue
+		}
+		seen[c.ID] = true
+
+		footnote := Footnote{Source: s.sources[c.ID-1]}
+		if content, ok := sourceContent(messages[:index], c.ID); ok {
+			footnote.Excerpt = excerpt(content, citingSentence(answer, c.Loc.Start))
+		} else if summary, ok := sourceSummary(messages[:index+1], c.ID); ok {
+			footnote.Excerpt = truncateExcerpt(summary)
+		}
+		footnotes = append(footnotes, footnote)
+	}
+	return footnotes
+}
+
+// sourceContent returns the latest contents of the source attached to one
+// of messages
+func sourceContent(messages []Message, id int) (string, bool) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != RoleUser {
+			continue
+		}
+		for _, a := range parseAttachments(messages[i].Content) {
+			if a.ID == id {
+				return a.Content, true
+			}
+		}
+	}
+	return "", false
+}
+
+// sourceSummary returns what a research run took from the source
+func sourceSummary(messages []Message, id int) (string, bool) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Research == nil {
+			continue
+		}
+		for _, source := range messages[i].Research.Sources {
+			if source.ID == id {
+				return source.Summary, true
+			}
+		}
+	}
+	return "", false
+}
+
+// citingSentence returns the text before the citation at i back to the end
+// of the previous sentence
+func citingSentence(answer string, i int) string {
+	start := strings.LastIndexAny(answer[:i], ".!?\n") + 1
+	return answer[start:i]
+}
+
+// excerpt returns the line of content that shares the most words with
+// sentence or the first line if none do
+func excerpt(content, sentence string) string {
+	words := map[string]bool{}
+	for _, w := range significantWords(sentence) {
+		words[w] = true
+	}
+
+	best, bestScore := "", -1
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		score := 0
+		counted := map[string]bool{}
+		for _, w := range significantWords(line) {
+			if words[w] && !counted[w] {
+				counted[w] = true
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = line, score
+		}
+	}
+	return truncateExcerpt(best)
+}
+
+// significantWords returns the lowercase words of s that are long enough
+// to say something about what s is about
+func significantWords(s string) []string {
+	var words []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(w) >= 4 {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+func truncateExcerpt(s string) string {
+	if r := []rune(s); len(r) > maxExcerpt {
+		return string(r[:maxExcerpt]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCitations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []int
+	}{
+		{"no citations", nil},
+		{"Go is fast [1].", []int{1}},
+		{"both [1][2] and [3, 4]", []int{1, 2, 3, 4}},
+		{"a [link](https://go.dev) and [2](x)", nil},
+		{"`xs[0]` and ```\nys[1]\n``` but [5]", []int{5}},
+		{"[0] [a] [1,b] [ 7 ]", []int{7}},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			var ids []int
+			for _, c := range ParseCitations(tt.input) {
+				ids = append(ids, c.ID)
+				if tt.input[c.Loc.Start] != '[' || tt.input[c.Loc.End-1] != ']' {
+					t.Errorf("bad location %s", c.Loc)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.expected) {
+				t.Errorf("got=%v. expected=%v", ids, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseAttachments(t *testing.T) {
+	sources := []attachment{
+		{Source{ID: 1, Kind: SourceFile, Name: `notes "draft".md`}, "line one\nline two"},
+		{Source{ID: 2, Kind: SourceLink, Name: "https://go.dev"}, "<html></html>"},
+	}
+
+	var b bytes.Buffer
+	b.WriteString("compare ")
+	for _, a := range sources {
+		writeSource(&b, a.Source, []byte(a.Content))
+	}
+	writeSource(&b, Source{Kind: SourceFile, Name: "tool.md"}, []byte("no id"))
+
+	got := parseAttachments(b.String())
+	if !reflect.DeepEqual(got, sources) {
+		t.Errorf("got=%+v. expected=%+v", got, sources)
+	}
+}
+
+func TestFootnotes(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.md")
+	os.WriteFile(notes, []byte("# Notes\n\nGo was released in 2009.\nRust in 2015."), 0o644)
+	other := filepath.Join(dir, "other.md")
+	os.WriteFile(other, []byte("nothing"), 0o644)
+
+	s := NewSession("test", &fakeBackend{})
+	first, err := s.attachSources(context.Background(), SourceFile, []string{notes}, attachOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.attachSources(context.Background(), SourceFile, []string{other, notes}, attachOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attached := parseAttachments(string(second))
+	if len(attached) != 2 || attached[0].ID != 2 || attached[1].ID != 1 {
+		t.Errorf("sources should keep their ids. got=%+v", attached)
+	}
+
+	s.commitSources()
+
+	answer := "Go was released in 2009 [1]. See [9]."
+	s.setHistory([]Message{
+		NewMessage(RoleUser, string(first)),
+		NewMessage(RoleAssistant, answer),
+		NewMessage(RoleUser, string(second)),
+		NewMessage(RoleAssistant, answer),
+	})
+
+	expected := []Footnote{{
+		Source:  Source{ID: 1, Kind: SourceFile, Name: notes},
+		Excerpt: "Go was released in 2009.",
+	}}
+	for _, index := range []int{1, 3} {
+		if got := s.Footnotes(index); !reflect.DeepEqual(got, expected) {
+			t.Errorf("got=%+v. expected=%+v", got, expected)
+		}
+	}
+}
+
+func TestSourcesAddedWithPrompt(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.md")
+	os.WriteFile(notes, []byte("Go was released in 2009."), 0o644)
+	other := filepath.Join(dir, "other.md")
+	os.WriteFile(other, []byte("nothing"), 0o644)
+
+	s := NewSession("test", &fakeBackend{chunks: []string{"ok"}})
+	prompt := fmt.Sprintf("@file(%s) @file(%s)", notes, filepath.Join(dir, "missing.md"))
+	if _, err := s.SendPrompt(context.Background(), prompt); err == nil {
+		t.Fatalf("expected the missing file to fail")
+	}
+	if got := s.Sources(); len(got) != 0 {
+		t.Fatalf("a prompt that wasn't sent shouldn't add sources. got=%+v", got)
+	}
+
+	ch, err := s.SendPrompt(context.Background(), fmt.Sprintf("@file(%s)", other))
+	if err != nil {
+		t.Fatalf("SendPrompt failed: %v", err)
+	}
+	for range ch {
+	}
+
+	expected := []Source{{ID: 1, Kind: SourceFile, Name: other}}
+	if got := s.Sources(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got=%+v. expected=%+v", got, expected)
+	}
+	if got := parseAttachments(s.Messages()[0].Content); len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("the prompt should cite the source as [1]. got=%+v", got)
+	}
+}
@@ -0,0 +1,259 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// how many times the model may call tools before answering a prompt
+	maxToolRounds = 8
+
+	// tool output is cut off after this many bytes so a large file
+	// doesn't fill the whole context
+	maxToolOutput = 32 * 1024
+)
+
+var errToolDenied = errors.New("the user didn't allow this call")
+
+// Tool is a function the model can call while answering a prompt.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  []ToolParameter
+
+	// Run executes a call. Its output or error is given to the model
+	Run func(ctx context.Context, args map[string]any) (string, error)
+}
+
+type ToolParameter struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+}
+
+// ToolCall is the model asking to run a tool.
+type ToolCall struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// String formats the call like a function call e.g. read_file(path="a.go")
+func (c ToolCall) String() string {
+	names := make([]string, 0, len(c.Arguments))
+	for name := range c.Arguments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]string, len(names))
+	for i, name := range names {
+		args[i] = fmt.Sprintf("%s=%q", name, fmt.Sprint(c.Arguments[name]))
+	}
+	return c.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// ToolBackend is implemented by backends that give ChatRequest.Tools to the
+// model and send ToolCalls events when it calls them.
+type ToolBackend interface {
+	SupportsTools() bool
+}
+
+// ToolCalls is sent by a backend before Done when the model wants to call
+// tools instead of answering. Session.SendPrompt runs them and continues.
+type ToolCalls struct {
+	Calls []ToolCall
+}
+
+// ToolRequested is sent by Session.SendPrompt before a tool is run. If
+// Approve isn't nil the call waits until true (run it) or false (don't)
+// is sent on it.
+type ToolRequested struct {
+	Call    ToolCall
+	Approve chan<- bool
+}
+
+// ToolFinished is sent with a tool's output after it's run.
+type ToolFinished struct {
+	Call   ToolCall
+	Output string
+	Err    error
+}
+
+func (ToolCalls) event()     {}
+func (ToolRequested) event() {}
+func (ToolFinished) event()  {}
+
+// DefaultTools lets the model do what the user can with @file and @link.
+func DefaultTools() []Tool {
+	return []Tool{
+		{
+			Name:        "read_file",
+			Description: "Reads a local file and returns its contents.",
+			Parameters: []ToolParameter{{
+				Name:        "path",
+				Type:        "string",
+				Description: "path of the file, relative to the current directory",
+				Required:    true,
+			}},
+			Run: func(ctx context.Context, args map[string]any) (string, error) {
+				path, err := stringArg(args, "path")
+				if err != nil {
+					return "", err
+				}
+				b, err := readFiles([]string{path})
+				return string(b), err
+			},
+		},
+		{
+			Name:        "fetch_link",
+			Description: "Downloads a web page and returns its contents.",
+			Parameters: []ToolParameter{{
+				Name:        "url",
+				Type:        "string",
+				Description: "the page's url including the scheme",
+				Required:    true,
+			}},
+			Run: func(ctx context.Context, args map[string]any) (string, error) {
+				url, err := stringArg(args, "url")
+				if err != nil {
+					return "", err
+				}
+				b, err := fetchLinks(ctx, []string{url})
+				return string(b), err
+			},
+		},
+	}
+}
+
+func stringArg(args map[string]any, name string) (string, error) {
+	s, ok := args[name].(string)
+	if !ok || s == "" {
+		return "", fmt.Errorf("missing string argument %q", name)
+	}
+	return s, nil
+}
+
+// Tools returns the tools the model may call. None are given to the model
+// unless they're enabled with SetTools.
+func (s *Session) Tools() []Tool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tools
+}
+
+// SetTools gives tools to the model with the following prompts. nil turns
+// tool calling off.
+func (s *Session) SetTools(tools []Tool) error {
+	if len(tools) > 0 {
+		b, ok := s.backend.(ToolBackend)
+		if !ok || !b.SupportsTools() {
+			return fmt.Errorf("tool calling is %w", ErrUnsupported)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tools = tools
+	return nil
+}
+
+// ConfirmTools reports whether ToolRequested events wait for approval.
+func (s *Session) ConfirmTools() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.confirmTools
+}
+
+func (s *Session) SetConfirmTools(confirm bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.confirmTools = confirm
+}
+
+func (s *Session) findTool(name string) (Tool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tool := range s.tools {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+	return Tool{}, false
+}
+
+// approve sends a ToolRequested for call and waits for the user's answer
+// unless calls don't have to be confirmed. ok is false if ctx was cancelled
+func (s *Session) approve(
+	ctx context.Context,
+	ch chan<- Event,
+	call ToolCall,
+) (approved, ok bool) {
+	if !s.ConfirmTools() {
+		return true, send(ctx, ch, ToolRequested{Call: call})
+	}
+	reply := make(chan bool, 1)
+	if !send(ctx, ch, ToolRequested{call, reply}) {
+		return false, false
+	}
+	select {
+	case approved = <-reply:
+		return approved, true
+	case <-ctx.Done():
+		return false, false
+	}
+}
+
+// runTool asks for approval if needed, runs call and returns the message
+// with its output for the model. ok is false if ctx was cancelled.
+func (s *Session) runTool(
+	ctx context.Context,
+	ch chan<- Event,
+	call ToolCall,
+) (msg Message, ok bool) {
+	approved, ok := s.approve(ctx, ch, call)
+	if !ok {
+		return Message{}, false
+	}
+
+	var (
+		output string
+		err    error
+	)
+	tool, found := s.findTool(call.Name)
+	switch {
+	case !approved:
+		err = errToolDenied
+	case !found:
+		err = fmt.Errorf("there is no tool called %q", call.Name)
+	default:
+		output, err = tool.Run(ctx, call.Arguments)
+	}
+	if len(output) > maxToolOutput {
+		output = output[:runeCut(output, maxToolOutput)] + "\n(the rest was cut off)"
+	}
+
+	if !send(ctx, ch, ToolFinished{call, output, err}) {
+		return Message{}, false
+	}
+
+	msg = NewMessage(RoleTool, output)
+	if err != nil {
+		msg.Content = "Error: " + err.Error()
+	}
+	msg.ToolName = call.Name
+	return msg, true
+}
+
+// runeCut returns where to cut s off at n bytes without splitting a
+// character. s must be longer than n
+func runeCut[T string | []byte](s T, n int) int {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
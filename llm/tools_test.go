@@ -0,0 +1,230 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// toolBackend calls echo_tool once and then answers with the last
+// message, which is the tool's output
+func toolBackend() *fakeBackend {
+	return &fakeBackend{tools: true, reply: func(n int, req ChatRequest) fakeReply {
+		if n == 0 {
+			call := ToolCall{Name: "echo_tool", Arguments: map[string]any{"text": "hi"}}
+			return fakeReply{calls: []ToolCall{call}}
+		}
+		return fakeReply{chunks: []string{req.Messages[len(req.Messages)-1].Content}}
+	}}
+}
+
+var echoTool = Tool{
+	Name: "echo_tool",
+	Run: func(ctx context.Context, args map[string]any) (string, error) {
+		return stringArg(args, "text")
+	},
+}
+
+func TestToolCalls(t *testing.T) {
+	tests := []struct {
+		approve  bool
+		expected string
+	}{
+		{true, "hi"},
+		{false, "Error: " + errToolDenied.Error()},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			backend := toolBackend()
+			s := NewSession("test", backend)
+			if err := s.SetTools([]Tool{echoTool}); err != nil {
+				t.Fatal(err)
+			}
+
+			ch, err := s.SendPrompt(context.Background(), "say hi")
+			if err != nil {
+				t.Fatalf("SendPrompt failed: %v", err)
+			}
+
+			var finished *ToolFinished
+			for ev := range ch {
+				switch ev := ev.(type) {
+				case ToolRequested:
+					if ev.Call.String() != `echo_tool(text="hi")` {
+						t.Errorf("bad call. got=%s", ev.Call)
+					}
+					ev.Approve <- tt.approve
+				case ToolFinished:
+					finished = &ev
+				}
+			}
+
+			if finished == nil {
+				t.Fatalf("expected a ToolFinished event")
+			}
+			if !tt.approve && !errors.Is(finished.Err, errToolDenied) {
+				t.Errorf("expected the call to be denied. got=%v", finished.Err)
+			}
+			if len(backend.requests[0].Tools) != 1 {
+				t.Errorf("expected the tools to be sent. got=%+v", backend.requests[0].Tools)
+			}
+
+			messages := s.Messages()
+			roles := make([]string, len(messages))
+			for i, msg := range messages {
+				roles[i] = string(msg.Role)
+			}
+			if r := strings.Join(roles, " "); r != "user assistant tool assistant" {
+				t.Fatalf("bad history. got=%q", r)
+			}
+			if len(messages[1].ToolCalls) != 1 || messages[2].ToolName != "echo_tool" {
+				t.Errorf("bad tool messages. got=%+v", messages[1:3])
+			}
+			if messages[3].Content != tt.expected {
+				t.Errorf("got=%q. expected=%q", messages[3].Content, tt.expected)
+			}
+		})
+	}
+}
+
+func TestToolCallsCancel(t *testing.T) {
+	backend := &fakeBackend{tools: true, reply: func(n int, req ChatRequest) fakeReply {
+		switch n {
+		case 0:
+			call := ToolCall{Name: "echo_tool", Arguments: map[string]any{"text": "hi"}}
+			return fakeReply{calls: []ToolCall{call}}
+		case 1:
+			return fakeReply{chunks: []string{"It said"}, block: true}
+		}
+		return fakeReply{chunks: []string{"Hi"}}
+	}}
+	s := NewSession("test", backend)
+	if err := s.SetTools([]Tool{echoTool}); err != nil {
+		t.Fatal(err)
+	}
+	s.SetConfirmTools(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := s.SendPrompt(ctx, "say hi")
+	if err != nil {
+		t.Fatalf("SendPrompt failed: %v", err)
+	}
+	for ev := range ch {
+		// cancelled while the second round is streaming
+		if _, ok := ev.(Token); ok {
+			cancel()
+		}
+	}
+
+	messages := s.Messages()
+	if len(messages) != 4 {
+		t.Fatalf("expected 4 messages in history. got=%+v", messages)
+	}
+	answer := messages[3]
+	if answer.Content != "It said" || !answer.Interrupted || answer.Stats != nil {
+		t.Errorf("expected an interrupted answer without stats. got=%+v", answer)
+	}
+}
+
+func TestSetToolsUnsupported(t *testing.T) {
+	s := NewSession("test", &fakeBackend{})
+	if err := s.SetTools(DefaultTools()); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported. got=%v", err)
+	}
+}
+
+func TestOllamaTools(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("the meeting is on friday"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.URL.Path != "/api/chat" {
+				t.Errorf("tools should be sent to /api/chat. got=%q", r.URL.Path)
+			}
+
+			var req ollamaChatRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("bad request body: %v", err)
+			}
+			if len(req.Tools) != 2 || req.Tools[0].Function.Parameters.Required[0] != "path" {
+				t.Errorf("bad tools. got=%+v", req.Tools)
+			}
+
+			if requests == 1 {
+				fmt.Fprintf(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"read_file","arguments":{"path":%q}}}]},"done":false}`+"\n", path)
+				fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true}`)
+				return
+			}
+
+			last := req.Messages[len(req.Messages)-1]
+			if last.Role != RoleTool || last.ToolName != "read_file" ||
+				!strings.Contains(last.Content, "friday") {
+				t.Errorf("expected the file in a tool message. got=%+v", last)
+			}
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"On friday."},"done":true}`)
+		},
+	))
+	defer server.Close()
+
+	s := NewSession("mistral", NewOllama(Endpoint{URL: server.URL}))
+	s.SetConfirmTools(false)
+	if err := s.SetTools(DefaultTools()); err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := s.SendPrompt(context.Background(), "when is the meeting?")
+	if err != nil {
+		t.Fatalf("SendPrompt failed: %v", err)
+	}
+	var last Event
+	for ev := range ch {
+		last = ev
+	}
+	if _, ok := last.(Done); !ok {
+		t.Fatalf("expected the stream to end with Done. got=%+v", last)
+	}
+
+	messages := s.Messages()
+	if answer := messages[len(messages)-1]; answer.Content != "On friday." {
+		t.Errorf("bad answer. got=%+v", answer)
+	}
+}
+
+func TestRuneCut(t *testing.T) {
+	tests := []struct {
+		input    string
+		n        int
+		expected string
+	}{
+		{"hello", 3, "hel"},
+		{"héllo", 2, "h"},
+		{"héllo", 3, "hé"},
+		{"🌍🌍", 5, "🌍"},
+		{"🌍", 2, ""},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			if got := tt.input[:runeCut(tt.input, tt.n)]; got != tt.expected {
+				t.Errorf("got=%q. expected=%q", got, tt.expected)
+			}
+			if got := runeCut([]byte(tt.input), tt.n); got != len(tt.expected) {
+				t.Errorf("got=%d. expected=%d", got, len(tt.expected))
+			}
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
 
+	"github.com/Hassan-Ibrahim-1/research/config"
 	"github.com/Hassan-Ibrahim-1/research/llm"
+	"github.com/Hassan-Ibrahim-1/research/store"
 	"github.com/Hassan-Ibrahim-1/research/ui"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -24,9 +28,66 @@ func main() {
 		log.SetOutput(io.Discard)
 	}
 
-	s := llm.NewSession("mistral")
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		os.Exit(runHistory(os.Args[2:]))
+	}
+
+	f := parseFlags()
+
+	cfg, err := loadConfig(f)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+
+	backend, err := cfg.NewBackend()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
 
-	m := ui.New(&s)
+	personas, err := loadPersonas()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+
+	s := llm.NewSession(cfg.Model, backend)
+	s.SetOptions(cfg.Options)
+	s.SetSystemPrompt(cfg.SystemPrompt)
+	s.SetTokenBudget(cfg.TokenBudget)
+	if cfg.Persona != "" {
+		p, err := config.FindPersona(personas, cfg.Persona)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+		s.SetPersona(p)
+	}
+	if cfg.Tools {
+		if err := s.SetTools(llm.DefaultTools()); err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+	}
+
+	sessions, err := openStore()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+
+	// the saved model, options and prompts replace the configured ones
+	if f.resume != "" {
+		snap, err := sessions.Load(f.resume)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+		s.Restore(snap)
+	}
+
+	m := ui.New(&s, personas, sessions)
 
 	p := tea.NewProgram(
 		m,
@@ -65,6 +126,144 @@ func main() {
 	// fmt.Print("\n")
 }
 
+type flags struct {
+	config  string
+	backend string
+	url     string
+	token   string
+	model   string
+	system  string
+	persona string
+	resume  string
+	budget  int
+	tools   bool
+	headers map[string]string
+
+	// generation options by name
+	options map[string]string
+}
+
+// flags left empty don't override the config file or environment
+func parseFlags() flags {
+	f := flags{
+		headers: map[string]string{},
+		options: map[string]string{},
+	}
+
+	flag.StringVar(&f.config, "config", "", "path to the config file")
+	flag.StringVar(&f.backend, "backend", "", "model server to use: ollama or openai")
+	flag.StringVar(&f.url, "url", "", "base url of the model server")
+	flag.StringVar(&f.token, "token", "", "bearer token sent to the model server")
+	flag.StringVar(&f.model, "model", "", "model to chat with")
+	flag.StringVar(&f.system, "system", "", "system prompt")
+	flag.StringVar(&f.persona, "persona", "", "persona to start with")
+	flag.StringVar(&f.resume, "resume", "", "id of a saved session to continue")
+	flag.BoolVar(&f.tools, "tools", false, "lets the model read files and fetch links")
+	flag.IntVar(
+		&f.budget,
+		"token_budget",
+		0,
+		"tokens the history may take up before it's summarized. defaults to 3/4 of num_ctx",
+	)
+	flag.Func(
+		"header",
+		"extra header sent to the model server as 'Key: Value'. can be repeated",
+		func(s string) error {
+			k, v, ok := strings.Cut(s, ":")
+			if !ok {
+				return fmt.Errorf("expected 'Key: Value' got %q", s)
+			}
+			f.headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			return nil
+		},
+	)
+	for _, name := range llm.OptionNames {
+		flag.Func(name, "sets the "+name+" generation option", func(s string) error {
+			f.options[name] = s
+			return nil
+		})
+	}
+	flag.Parse()
+
+	return f
+}
+
+func loadConfig(f flags) (config.Config, error) {
+	path := f.config
+	if path == "" {
+		var err error
+		path, err = config.Path()
+		if err != nil {
+			return config.Config{}, err
+		}
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	// the backend decides which environment variables are read
+	if f.backend != "" {
+		cfg.Backend = f.backend
+	}
+
+	if err := cfg.ApplyEnv(os.Getenv); err != nil {
+		return config.Config{}, err
+	}
+
+	if f.url != "" {
+		cfg.URL = f.url
+	}
+	if f.token != "" {
+		cfg.Token = f.token
+	}
+	if f.model != "" {
+		cfg.Model = f.model
+	}
+	if f.system != "" {
+		cfg.SystemPrompt = f.system
+	}
+	if f.persona != "" {
+		cfg.Persona = f.persona
+	}
+	if f.budget != 0 {
+		cfg.TokenBudget = f.budget
+	}
+	if f.tools {
+		cfg.Tools = true
+	}
+	if len(f.headers) > 0 && cfg.Headers == nil {
+		cfg.Headers = map[string]string{}
+	}
+	for k, v := range f.headers {
+		cfg.Headers[k] = v
+	}
+	for name, value := range f.options {
+		if err := cfg.Options.Set(name, value); err != nil {
+			return config.Config{}, err
+		}
+	}
+
+	return cfg, nil
+}
+
+func loadPersonas() ([]llm.Persona, error) {
+	dir, err := config.PersonasDir()
+	if err != nil {
+		return nil, err
+	}
+	return config.LoadPersonas(dir)
+}
+
+func openStore() (*store.Store, error) {
+	dir, err := config.SessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	return store.New(dir), nil
+}
+
 func enableLogs() io.WriteCloser {
 	f, err := tea.LogToFile("debug.log", "")
 	if err != nil {
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+)
+
+// Filter returns the sessions whose title, model or id fuzzy match query,
+// best matches first. Sessions that match equally well keep their order.
+func Filter(snaps []llm.Snapshot, query string) []llm.Snapshot {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return snaps
+	}
+
+	type match struct {
+		snap  llm.Snapshot
+		score int
+	}
+	var matches []match
+	for _, snap := range snaps {
+		best, found := 0, false
+		for _, field := range []string{snap.DisplayTitle(), snap.Model, snap.ID} {
+			if score, ok := fuzzyScore(query, field); ok && (!found || score > best) {
+				best, found = score, true
+			}
+		}
+		if found {
+			matches = append(matches, match{snap, best})
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b match) int {
+		return b.score - a.score
+	})
+
+	filtered := make([]llm.Snapshot, len(matches))
+	for i, m := range matches {
+		filtered[i] = m.snap
+	}
+	return filtered
+}
+
+// fuzzyScore reports whether every rune of query appears in s in order,
+// ignoring case. Runes that follow the previous match or start a word
+// score higher so "rag" ranks "RAG pipelines" above "rust async guide".
+func fuzzyScore(query, s string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	runes := []rune(strings.ToLower(s))
+
+	score, qi := 0, 0
+	last := -2
+	for i, r := range runes {
+		if qi == len(q) {
+			break
+		}
+		if r != q[qi] {
+			continue
+		}
+
+		score++
+		if i == last+1 {
+			score += 2
+		}
+		if i == 0 || !unicode.IsLetter(runes[i-1]) && !unicode.IsDigit(runes[i-1]) {
+			score += 1
+		}
+		last = i
+		qi++
+	}
+	return score, qi == len(q)
+}
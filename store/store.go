@@ -0,0 +1,157 @@
+// Package store saves sessions as json files so they can be resumed later.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+)
+
+var ErrNotFound = errors.New("session not found")
+
+// Store keeps one <id>.json file per session in a directory.
+type Store struct {
+	dir string
+}
+
+// dir is created when the first session is saved.
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("Invalid session id %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// Save writes snap to a temporary file first so a crash while saving
+// doesn't lose the previous save.
+func (s *Store) Save(snap llm.Snapshot) error {
+	path, err := s.path(snap.ID)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("Failed to save session: %w", err)
+	}
+
+	f, err := os.CreateTemp(s.dir, snap.ID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("Failed to save session: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("Failed to save session: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Failed to save session: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("Failed to save session: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) Load(id string) (llm.Snapshot, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return llm.Snapshot{}, err
+	}
+	return load(path)
+}
+
+func load(path string) (llm.Snapshot, error) {
+	id := strings.TrimSuffix(filepath.Base(path), ".json")
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return llm.Snapshot{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return llm.Snapshot{}, err
+	}
+
+	var snap llm.Snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return llm.Snapshot{}, fmt.Errorf("Failed to parse session %s: %w", id, err)
+	}
+	if snap.Version < 1 || snap.Version > llm.SnapshotVersion {
+		return llm.Snapshot{}, fmt.Errorf(
+			"Session %s has version %d. this version of research reads up to version %d",
+			id,
+			snap.Version,
+			llm.SnapshotVersion,
+		)
+	}
+	// the file name wins if the file was renamed
+	snap.ID = id
+	return snap, nil
+}
+
+// List returns every saved session, most recently updated first. Files
+// that can't be read are skipped.
+func (s *Store) List() ([]llm.Snapshot, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []llm.Snapshot
+	for _, path := range paths {
+		snap, err := load(path)
+		if err != nil {
+			log.Println("skipping session:", err)
+			continue
+		}
+		snaps = append(snaps, snap)
+	}
+
+	slices.SortFunc(snaps, func(a, b llm.Snapshot) int {
+		return b.Updated.Compare(a.Updated)
+	})
+	return snaps, nil
+}
+
+func (s *Store) Remove(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return err
+}
+
+// Rename changes a session's title. The id and file name stay the same.
+func (s *Store) Rename(id string, title string) error {
+	snap, err := s.Load(id)
+	if err != nil {
+		return err
+	}
+	snap.Title = title
+	return s.Save(snap)
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+)
+
+func TestSaveLoad(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "sessions"))
+
+	var options llm.Options
+	_ = options.Set("temperature", "0.2")
+	msg := llm.NewMessage(llm.RoleUser, "Summarize this: ...")
+	msg.Raw = "Summarize this: @file(paper.txt)"
+	msg.Time = time.Date(2024, 3, 12, 15, 45, 1, 0, time.UTC)
+
+	snap := llm.Snapshot{
+		Version:      llm.SnapshotVersion,
+		ID:           "20240312-154501-9f2c",
+		Created:      msg.Time,
+		Updated:      msg.Time,
+		Model:        "mistral",
+		Options:      options,
+		SystemPrompt: "Be brief.",
+		Messages:     []llm.Message{msg},
+	}
+	if err := s.Save(snap); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	loaded, err := s.Load(snap.ID)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if loaded.Model != "mistral" || loaded.SystemPrompt != "Be brief." {
+		t.Errorf("bad session. got=%+v", loaded)
+	}
+	if loaded.Options.String() != "temperature=0.2" {
+		t.Errorf("bad options. got=%q", loaded.Options.String())
+	}
+	if len(loaded.Messages) != 1 || !loaded.Messages[0].Time.Equal(msg.Time) ||
+		loaded.Messages[0].Raw != msg.Raw {
+		t.Errorf("bad messages. got=%+v", loaded.Messages)
+	}
+
+	if _, err := s.Load("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound. got=%v", err)
+	}
+	if _, err := s.Load("../config"); err == nil {
+		t.Errorf("expected an error for an id that isn't a file name")
+	}
+}
+
+func TestLoadNewerVersion(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(
+		filepath.Join(dir, "future.json"),
+		[]byte(`{"version": 1000, "model": "mistral"}`),
+		0o644,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(dir).Load("future"); err == nil {
+		t.Errorf("expected an error for a session from a newer version")
+	}
+}
+
+func TestList(t *testing.T) {
+	s := New(t.TempDir())
+	start := time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c"} {
+		err := s.Save(llm.Snapshot{
+			Version: llm.SnapshotVersion,
+			ID:      id,
+			Updated: start.Add(time.Duration(i) * time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snaps, err := s.List()
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	var ids []string
+	for _, snap := range snaps {
+		ids = append(ids, snap.ID)
+	}
+	if len(ids) != 3 || ids[0] != "c" || ids[2] != "a" {
+		t.Errorf("expected the most recent session first. got=%v", ids)
+	}
+}
+
+func TestRemoveRename(t *testing.T) {
+	s := New(t.TempDir())
+	err := s.Save(llm.Snapshot{Version: llm.SnapshotVersion, ID: "a", Model: "mistral"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Rename("a", "transformers reading list"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+	snap, err := s.Load("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Title != "transformers reading list" || snap.Model != "mistral" {
+		t.Errorf("bad session after rename. got=%+v", snap)
+	}
+
+	if err := s.Remove("a"); err != nil {
+		t.Fatalf("Failed to remove: %v", err)
+	}
+	if _, err := s.Load("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after removing. got=%v", err)
+	}
+	if err := s.Remove("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound. got=%v", err)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	snaps := []llm.Snapshot{
+		{ID: "1", Title: "rust async guide", Model: "mistral"},
+		{ID: "2", Title: "RAG pipelines", Model: "qwen2.5"},
+		{ID: "3", Title: "protein folding", Model: "llama3"},
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"1", "2", "3"}},
+		{"rag", []string{"2", "1"}},
+		{"qwen", []string{"2"}},
+		{"PRTN", []string{"3"}},
+		{"xyz", nil},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			var ids []string
+			for _, snap := range Filter(snaps, tt.query) {
+				ids = append(ids, snap.ID)
+			}
+			if !slices.Equal(ids, tt.expected) {
+				t.Errorf("got=%v. expected=%v", ids, tt.expected)
+			}
+		})
+	}
+}
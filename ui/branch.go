@@ -0,0 +1,191 @@
+package ui
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	lg "github.com/charmbracelet/lipgloss"
+)
+
+var selectedStyle = lg.NewStyle().Bold(true).Foreground(lg.Color("12"))
+
+const selectHelp = "↑/↓ select · ←/→ switch branch · e edit · r regenerate · f sources · esc done"
+
+// renderHistory replaces the chat with the session's messages, rendered
+// the same way as when they were sent and received. Only the first limit
+// messages are rendered unless limit is negative. Messages with
+// alternatives show which one is on the current branch.
+func (m *Model) renderHistory(limit int) {
+	m.messages = ""
+	messages := m.session.Messages()
+	if limit >= 0 {
+		messages = messages[:min(limit, len(messages))]
+	}
+
+	selectedLine := -1
+	for i, msg := range messages {
+		if i == m.selected {
+			selectedLine = strings.Count(m.messages, "\n")
+			m.messages += selectedStyle.Render("▶ "+selectHelp) + "\n"
+		}
+
+		var content string
+		switch {
+		case msg.Role == llm.RoleTool || len(msg.ToolCalls) > 0 && msg.Content == "":
+			m.renderToolMessage(msg)
+			continue
+		case msg.Summary:
+			m.reportInfo("the earlier conversation was condensed into a summary")
+			continue
+		case msg.Role == llm.RoleUser:
+			content = "User: " + cmp.Or(msg.Raw, msg.Content) + "\n"
+		case msg.Role == llm.RoleAssistant:
+			if msg.Research != nil {
+				m.renderResearchRun(msg.Research)
+			}
+			content = msg.Content
+			if msg.Interrupted {
+				content += "\n\n*(interrupted)*"
+			}
+			if msg.Stats != nil {
+				m.lastStats = msg.Stats
+			}
+		default:
+			continue
+		}
+
+		r, err := glamour.Render(content, glamourStyle)
+		if err != nil {
+			m.reportError(err)
+			continue
+		}
+		m.messages += r
+		m.renderToolMessage(msg)
+		if msg.Role == llm.RoleAssistant {
+			m.renderFootnotes(i)
+			m.renderQuotes(msg.Quotes)
+		}
+
+		if current, count := m.session.Branches(i); count > 1 {
+			m.messages += infoTextStyle.Render(
+				fmt.Sprintf("  ‹ %d/%d ›", current, count),
+			) + "\n"
+		}
+	}
+	m.redrawViewport(m.messages)
+
+	if selectedLine >= 0 {
+		m.viewport.SetYOffset(selectedLine)
+	}
+}
+
+// startSelecting selects the last prompt so it can be edited or so its
+// answer can be regenerated
+func (m *Model) startSelecting() {
+	if m.readingLlmResponse {
+		return
+	}
+	messages := m.session.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == llm.RoleUser {
+			m.selected = i
+			m.editing = -1
+			m.prompt.Blur()
+			m.renderHistory(-1)
+			return
+		}
+	}
+	m.reportInfo("there are no prompts to select yet")
+}
+
+func (m *Model) stopSelecting() {
+	m.selected = -1
+}
+
+// updateSelection handles keys while a message is selected
+func (m *Model) updateSelection(msg tea.KeyMsg) tea.Cmd {
+	messages := m.session.Messages()
+
+	switch msg.String() {
+	case "up", "k":
+		for i := m.selected - 1; i >= 0; i-- {
+			if !messages[i].Summary {
+				m.selected = i
+				break
+			}
+		}
+	case "down", "j":
+		if m.selected < len(messages)-1 {
+			m.selected++
+		}
+	case "left", "h":
+		m.session.SwitchBranch(m.selected, -1)
+	case "right", "l":
+		m.session.SwitchBranch(m.selected, 1)
+	case "e", "enter":
+		selected := messages[m.selected]
+		if selected.Role != llm.RoleUser {
+			m.reportError(fmt.Errorf("Only prompts can be edited. use r to regenerate an answer"))
+			return nil
+		}
+		m.editing = m.selected
+		m.stopSelecting()
+		m.renderHistory(-1)
+		m.prompt.SetValue(cmp.Or(selected.Raw, selected.Content))
+		m.prompt.Focus()
+		m.reportInfo("editing a prompt. alt+enter sends it as a new branch, esc cancels")
+		return nil
+	case "r":
+		index := m.selected
+		if messages[index].Role != llm.RoleAssistant {
+			m.reportError(fmt.Errorf("Only answers can be regenerated. use e to edit a prompt"))
+			return nil
+		}
+		m.stopSelecting()
+		m.renderHistory(index)
+		return m.startResponse(func(ctx context.Context) (<-chan llm.Event, error) {
+			return m.session.Regenerate(ctx, index)
+		})
+	case "f":
+		if messages[m.selected].Role != llm.RoleAssistant {
+			m.reportError(fmt.Errorf("Only answers cite sources"))
+			return nil
+		}
+		m.toggleFootnotes(m.selected)
+	case "esc", "q":
+		m.stopSelecting()
+	default:
+		return nil
+	}
+
+	m.renderHistory(-1)
+	return nil
+}
+
+// cancelEditing goes back to sending new prompts
+func (m *Model) cancelEditing() bool {
+	if m.editing < 0 {
+		return false
+	}
+	m.editing = -1
+	m.prompt.SetValue("")
+	m.reportInfo("stopped editing")
+	return true
+}
+
+// startResponse renders the history again once the response is done so
+// the new branch is shown
+func (m *Model) startResponse(
+	send func(ctx context.Context) (<-chan llm.Event, error),
+) tea.Cmd {
+	m.prompt.Blur()
+	m.rerenderHistory = true
+	return func() tea.Msg {
+		return llmResponseStartMsg{send}
+	}
+}
@@ -0,0 +1,394 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Hassan-Ibrahim-1/research/config"
+	"github.com/Hassan-Ibrahim-1/research/export"
+	"github.com/Hassan-Ibrahim-1/research/llm"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// slashCommand is run when a prompt starts with '/' instead of the prompt
+// being sent to the model
+type slashCommand struct {
+	name  string
+	usage string
+	help  string
+	run   func(m *Model, args []string) (tea.Cmd, error)
+
+	// raw commands get the rest of the line as it was typed as their only
+	// argument instead of its words
+	raw bool
+}
+
+const personasDirHint = "~/.config/research/personas"
+
+// initialized in init because /help refers to it
+var slashCommands []slashCommand
+
+func init() {
+	slashCommands = []slashCommand{
+		{
+			name:  "model",
+			usage: "/model [name]",
+			help:  "switches to another model. without a name it lists the installed models",
+			run:   switchModel,
+		},
+		{
+			name:  "set",
+			usage: "/set <option> <value>",
+			help:  "sets a generation option: " + strings.Join(llm.OptionNames, ", "),
+			run:   setOption,
+		},
+		{
+			name:  "unset",
+			usage: "/unset <option>",
+			help:  "resets a generation option to the server's default",
+			run:   unsetOption,
+		},
+		{
+			name:  "options",
+			usage: "/options",
+			help:  "shows the generation options",
+			run:   showOptions,
+		},
+		{
+			name:  "budget",
+			usage: "/budget [tokens]",
+			help:  "shows or sets how many tokens the history may use before it's summarized. 0 follows num_ctx",
+			run:   tokenBudget,
+		},
+		{
+			name:  "system",
+			usage: "/system [prompt]",
+			help:  "shows or sets the system prompt. /system - clears it",
+			run:   systemPrompt,
+			raw:   true,
+		},
+		{
+			name:  "persona",
+			usage: "/persona <name>",
+			help:  "switches to a persona's system prompt, model and options",
+			run:   switchPersona,
+		},
+		{
+			name:  "personas",
+			usage: "/personas",
+			help:  "lists the personas in " + personasDirHint,
+			run:   listPersonas,
+		},
+		{
+			name:  "research",
+			usage: "/research <question>",
+			help:  "plans the research, reads the attached and suggested sources and writes a report that cites them",
+			run:   startResearch,
+			raw:   true,
+		},
+		{
+			name:  "tools",
+			usage: "/tools [on|auto|off]",
+			help:  "lets the model read files and fetch links. on asks before every call, auto doesn't",
+			run:   switchTools,
+		},
+		{
+			name:  "resume",
+			usage: "/resume [id]",
+			help:  "resumes a saved session. without an id it lists them",
+			run:   resumeSession,
+		},
+		{
+			name:  "history",
+			usage: "/history",
+			help:  "opens the list of saved sessions. ctrl+o toggles it too",
+			run:   showHistory,
+		},
+		{
+			name:  "export",
+			usage: "/export [format|file]",
+			help:  "writes the conversation as markdown, html or json. defaults to <id>.md in the current directory",
+			run:   exportSession,
+		},
+		{
+			name:  "help",
+			usage: "/help",
+			help:  "shows this message",
+			run:   showHelp,
+		},
+	}
+}
+
+func isSlashCommand(prompt string) bool {
+	return strings.HasPrefix(strings.TrimSpace(prompt), "/")
+}
+
+func (m *Model) runSlashCommand(prompt string) (tea.Cmd, error) {
+	prompt = strings.TrimSpace(prompt)
+	name, rest := prompt, ""
+	if i := strings.IndexFunc(prompt, unicode.IsSpace); i >= 0 {
+		name, rest = prompt[:i], prompt[i+1:]
+	}
+	name = strings.TrimPrefix(name, "/")
+
+	for _, cmd := range slashCommands {
+		if cmd.name != name {
+			continue
+		}
+		args := strings.Fields(rest)
+		if cmd.raw && len(args) > 0 {
+			args = []string{rest}
+		}
+		return cmd.run(m, args)
+	}
+	return nil, fmt.Errorf("Unknown command /%s. type /help to see every command", name)
+}
+
+func switchModel(m *Model, args []string) (tea.Cmd, error) {
+	if len(args) == 0 {
+		return listModels(m.session), nil
+	}
+	return m.switchModel(args[0]), nil
+}
+
+func setOption(m *Model, args []string) (tea.Cmd, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("usage: /set <option> <value>")
+	}
+
+	options := m.session.Options()
+	err := options.Set(args[0], strings.Join(args[1:], " "))
+	if err != nil {
+		return nil, err
+	}
+	m.session.SetOptions(options)
+
+	m.reportInfo("set " + args[0])
+	return nil, nil
+}
+
+func unsetOption(m *Model, args []string) (tea.Cmd, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("usage: /unset <option>")
+	}
+
+	options := m.session.Options()
+	if err := options.Unset(args[0]); err != nil {
+		return nil, err
+	}
+	m.session.SetOptions(options)
+
+	m.reportInfo("unset " + args[0])
+	return nil, nil
+}
+
+func showOptions(m *Model, args []string) (tea.Cmd, error) {
+	options := m.session.Options().String()
+	if options == "" {
+		options = "every option is using the server's default"
+	}
+	m.reportInfo(options)
+	return nil, nil
+}
+
+func tokenBudget(m *Model, args []string) (tea.Cmd, error) {
+	if len(args) == 0 {
+		m.reportInfo(fmt.Sprintf(
+			"the history uses ~%d of %d tokens",
+			m.session.ContextUsage(),
+			m.session.TokenBudget(),
+		))
+		return nil, nil
+	}
+
+	budget, err := strconv.Atoi(args[0])
+	if err != nil || budget < 0 {
+		return nil, fmt.Errorf("usage: /budget [tokens]")
+	}
+	m.session.SetTokenBudget(budget)
+
+	m.reportInfo(fmt.Sprintf("set the token budget to %d", m.session.TokenBudget()))
+	return nil, nil
+}
+
+func systemPrompt(m *Model, args []string) (tea.Cmd, error) {
+	switch {
+	case len(args) == 0:
+		prompt := m.session.SystemPrompt()
+		if prompt == "" {
+			prompt = "there is no system prompt"
+		}
+		m.reportInfo(prompt)
+
+	case strings.TrimSpace(args[0]) == "-":
+		m.session.SetSystemPrompt("")
+		m.reportInfo("cleared the system prompt")
+
+	default:
+		m.session.SetSystemPrompt(args[0])
+		m.reportInfo("set the system prompt")
+	}
+	return nil, nil
+}
+
+func switchPersona(m *Model, args []string) (tea.Cmd, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("usage: /persona <name>")
+	}
+
+	p, err := config.FindPersona(m.personas, strings.Join(args, " "))
+	if err != nil {
+		return nil, err
+	}
+	m.session.SetPersona(p)
+
+	m.reportInfo("switched to " + p.Name)
+	return nil, nil
+}
+
+func listPersonas(m *Model, args []string) (tea.Cmd, error) {
+	if len(m.personas) == 0 {
+		m.reportInfo("there are no personas in " + personasDirHint)
+		return nil, nil
+	}
+
+	b := strings.Builder{}
+	for _, p := range m.personas {
+		model := p.Model
+		if model == "" {
+			model = "current model"
+		}
+		fmt.Fprintf(&b, "%-24s %s\n", p.Name, model)
+	}
+	m.reportInfo(b.String())
+	return nil, nil
+}
+
+func startResearch(m *Model, args []string) (tea.Cmd, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("usage: /research <question>")
+	}
+
+	question := args[0]
+	if err := m.renderPrompt(question); err != nil {
+		return nil, err
+	}
+	m.prompt.Blur()
+
+	session := m.session
+	return func() tea.Msg {
+		return llmResponseStartMsg{func(ctx context.Context) (<-chan llm.Event, error) {
+			return session.Research(ctx, question)
+		}}
+	}, nil
+}
+
+func switchTools(m *Model, args []string) (tea.Cmd, error) {
+	if len(args) == 0 {
+		tools := m.session.Tools()
+		if len(tools) == 0 {
+			m.reportInfo("tools are off")
+			return nil, nil
+		}
+		b := strings.Builder{}
+		for _, tool := range tools {
+			fmt.Fprintf(&b, "%-24s %s\n", tool.Name, tool.Description)
+		}
+		if !m.session.ConfirmTools() {
+			b.WriteString("calls aren't confirmed\n")
+		}
+		m.reportInfo(b.String())
+		return nil, nil
+	}
+
+	switch args[0] {
+	case "on", "auto":
+		if err := m.session.SetTools(llm.DefaultTools()); err != nil {
+			return nil, err
+		}
+		m.session.SetConfirmTools(args[0] == "on")
+		m.reportInfo("turned tools " + args[0])
+	case "off":
+		m.session.SetTools(nil)
+		m.reportInfo("turned tools off")
+	default:
+		return nil, fmt.Errorf("usage: /tools [on|auto|off]")
+	}
+	return nil, nil
+}
+
+func resumeSession(m *Model, args []string) (tea.Cmd, error) {
+	if m.store == nil {
+		return nil, fmt.Errorf("Sessions aren't being saved")
+	}
+	if len(args) == 0 {
+		return listSessions(m.store), nil
+	}
+	return loadSession(m.store, args[0]), nil
+}
+
+func showHistory(m *Model, args []string) (tea.Cmd, error) {
+	if m.sidebar != nil {
+		return nil, nil
+	}
+	return m.toggleSidebar(), nil
+}
+
+func exportSession(m *Model, args []string) (tea.Cmd, error) {
+	snap := m.session.Snapshot()
+	if len(snap.Messages) == 0 {
+		return nil, fmt.Errorf("There's nothing to export yet")
+	}
+
+	format := export.Markdown
+	path := ""
+	if len(args) > 0 {
+		if f, err := export.ParseFormat(args[0]); err == nil {
+			format = f
+		} else if f, ok := export.FormatOf(args[0]); ok {
+			format = f
+			path = args[0]
+		} else {
+			return nil, err
+		}
+	}
+	if path == "" {
+		path = snap.ID + format.Ext()
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if err := export.WriteFile(path, snap, format); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("%s already exists. pick another file name, /export <file>", path)
+		}
+		return nil, fmt.Errorf("Failed to export: %w", err)
+	}
+	m.reportInfo("exported to " + path)
+	return nil, nil
+}
+
+func showHelp(m *Model, args []string) (tea.Cmd, error) {
+	b := strings.Builder{}
+	for _, cmd := range slashCommands {
+		fmt.Fprintf(&b, "%-24s %s\n", cmd.usage, cmd.help)
+	}
+
+	b.WriteString("\ncommands in prompts:\n")
+	for _, cmd := range llm.PromptCommands() {
+		help := cmd.Help
+		if len(cmd.Aliases) > 0 {
+			help += ". also @" + strings.Join(cmd.Aliases, ", @")
+		}
+		fmt.Fprintf(&b, "%-32s %s\n", cmd.Usage(), help)
+	}
+	m.reportInfo(b.String())
+	return nil, nil
+}
@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Hassan-Ibrahim-1/research/command"
+	"github.com/Hassan-Ibrahim-1/research/llm"
+
+	lg "github.com/charmbracelet/lipgloss"
+)
+
+// more than this many diagnostics are summed up so the prompt doesn't push
+// the chat off the screen
+const maxDiagnostics = 3
+
+var diagnosticStyle = lg.NewStyle().Foreground(lg.Color("1"))
+
+// updateDiagnostics checks the commands in the prompt as it's typed
+func (m *Model) updateDiagnostics() {
+	var diagnostics []command.Diagnostic
+	if text := m.prompt.String(); !isSlashCommand(text) {
+		diagnostics = llm.Diagnose(text)
+	}
+	m.setDiagnostics(diagnostics)
+}
+
+func (m *Model) setDiagnostics(diagnostics []command.Diagnostic) {
+	if slices.Equal(diagnostics, m.diagnostics) {
+		return
+	}
+	m.diagnostics = diagnostics
+	m.resizeViewport()
+}
+
+// checkPrompt keeps a prompt with broken commands from being sent. the
+// prompt is put back so it can be fixed
+func (m *Model) checkPrompt(prompt string) error {
+	diagnostics := llm.Diagnose(prompt)
+	if len(diagnostics) == 0 {
+		return nil
+	}
+	m.prompt.SetValue(prompt)
+	m.setDiagnostics(diagnostics)
+	return errors.New("The prompt wasn't sent. Fix the commands under it or escape the @ with \\@")
+}
+
+func (m *Model) diagnosticsView() string {
+	text := m.prompt.String()
+	b := strings.Builder{}
+	for i, d := range m.diagnostics {
+		if i == maxDiagnostics {
+			fmt.Fprintf(&b, "✗ and %d more\n", len(m.diagnostics)-i)
+			break
+		}
+		line, col := position(text, d.Loc.Start)
+		fmt.Fprintf(&b, "✗ %d:%d %s\n", line, col, d.Error())
+	}
+	return diagnosticStyle.Width(m.width).Render(strings.TrimSuffix(b.String(), "\n"))
+}
+
+// position returns the line and column of offset i in s, both counted
+// from 1
+func position(s string, i int) (line, col int) {
+	i = min(i, len(s))
+	line = strings.Count(s[:i], "\n") + 1
+	col = len([]rune(s[strings.LastIndexByte(s[:i], '\n')+1:i])) + 1
+	return line, col
+}
@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+
+	lg "github.com/charmbracelet/lipgloss"
+)
+
+var (
+	excerptStyle = lg.NewStyle().Italic(true).Foreground(lg.Color("250"))
+
+	unverifiedStyle = lg.NewStyle().Foreground(lg.Color("3"))
+)
+
+// renderFootnotes lists the sources cited by the message at index. the
+// excerpts are only shown once the footnotes are expanded with f
+func (m *Model) renderFootnotes(index int) {
+	footnotes := m.session.Footnotes(index)
+	if len(footnotes) == 0 {
+		return
+	}
+
+	expanded := m.expandedFootnotes[index]
+	b := strings.Builder{}
+	for _, f := range footnotes {
+		fmt.Fprintf(&b, "  [%d] %s\n", f.Source.ID, f.Source.Name)
+		if expanded && f.Excerpt != "" {
+			b.WriteString(excerptStyle.Render("      “"+f.Excerpt+"”") + "\n")
+		}
+	}
+	m.reportInfo(b.String())
+}
+
+func (m *Model) toggleFootnotes(index int) {
+	if m.expandedFootnotes == nil {
+		m.expandedFootnotes = map[int]bool{}
+	}
+	m.expandedFootnotes[index] = !m.expandedFootnotes[index]
+}
+
+// renderQuotes flags the quotes of an answer that couldn't be found in the
+// attachments word for word, see llm.Message.Quotes
+func (m *Model) renderQuotes(quotes []llm.Quote) {
+	if len(quotes) == 0 {
+		return
+	}
+
+	exact := 0
+	b := strings.Builder{}
+	for _, q := range quotes {
+		switch q.Status {
+		case llm.QuoteExact:
+			exact++
+		case llm.QuoteFuzzy:
+			fmt.Fprintf(&b, "  ≈ “%s” differs from [%d]: “%s”\n", q.Text, q.SourceID, q.Match)
+		case llm.QuoteUnverified:
+			source := "any attachment"
+			if q.SourceID > 0 {
+				source = fmt.Sprintf("[%d]", q.SourceID)
+			}
+			fmt.Fprintf(&b, "  ✗ “%s” isn't in %s\n", q.Text, source)
+		}
+	}
+
+	if exact > 0 {
+		m.reportInfo(fmt.Sprintf("  ✓ %d of %d quotes match the sources", exact, len(quotes)))
+	}
+	if b.Len() > 0 {
+		m.messages += m.wrapString(unverifiedStyle.Render(strings.TrimRight(b.String(), "\n")) + "\n")
+		m.redrawViewport(m.messages)
+	}
+}
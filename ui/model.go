@@ -1,11 +1,16 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/Hassan-Ibrahim-1/research/command"
 	"github.com/Hassan-Ibrahim-1/research/llm"
+	"github.com/Hassan-Ibrahim-1/research/store"
 	"github.com/Hassan-Ibrahim-1/research/ui/prompt"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
@@ -28,26 +33,60 @@ var (
 	}()
 
 	errorStyle = lg.NewStyle().Foreground(lg.Color("31")).Bold(true)
+
+	thinkingStyle = lg.NewStyle().Faint(true).Italic(true)
+
+	infoTextStyle = lg.NewStyle().Foreground(lg.Color("244"))
+
+	onlineStyle  = lg.NewStyle().Foreground(lg.Color("2"))
+	offlineStyle = lg.NewStyle().Foreground(lg.Color("1"))
 )
 
-const glamourStyle = "dark"
+const (
+	glamourStyle = "dark"
+
+	// how often the model server is checked while the app is open
+	healthCheckInterval = 15 * time.Second
+)
 
 type llmResponseStartMsg struct {
-	prompt string
+	// sends the prompt to the session
+	send func(ctx context.Context) (<-chan llm.Event, error)
 }
 
-type llmPartialResponseMsg struct {
-	content string
-	ch      <-chan string
+type llmEventMsg struct {
+	event llm.Event
+	ch    <-chan llm.Event
 }
 
 type llmResponseDoneMsg struct{}
 
+// healthMsg is the result of pinging the session's backend
+type healthMsg struct {
+	err error
+}
+
+type modelsListedMsg struct {
+	models []llm.ModelInfo
+	err    error
+}
+
+// modelCheckedMsg is sent after the session switches models or on startup
+type modelCheckedMsg struct {
+	details llm.ModelDetails
+	err     error
+}
+
 type Model struct {
 	viewport viewport.Model
 	ready    bool
 	prompt   prompt.Model
 
+	// width of the terminal. the viewport is narrower when the sidebar
+	// is open
+	width  int
+	height int
+
 	// messages between the user and llm that are rendered using glamour
 	// when readingLlmResponse is false messages is displayed to the user
 	messages string
@@ -58,19 +97,183 @@ type Model struct {
 	// is displayed to the user
 	currentMessage *string
 
+	// reasoning of a thinking model. only shown while the response is
+	// being streamed
+	currentThinking string
+
+	// set if the response ended with an error
+	responseErr error
+
+	// stats of the last completed response
+	lastStats *llm.Stats
+
+	// set if the history was condensed after the current response.
+	// reported once the response is rendered
+	compacted *llm.Compacted
+
 	readingLlmResponse bool
 
-	session *llm.Session
+	// cancels the response that's being read. nil when readingLlmResponse
+	// is false. interrupted is set if it was called by the user
+	cancelResponse context.CancelFunc
+	interrupted    bool
+
+	session  *llm.Session
+	personas []llm.Persona
+
+	// where the session is saved after every response. nil disables saving
+	store *store.Store
+
+	// healthChecked is false until the first health check finishes.
+	// healthErr is the error returned by the last health check
+	healthChecked bool
+	healthErr     error
+
+	// overlay that's shown instead of the chat when it isn't nil
+	picker *picker
+
+	// list of saved sessions shown next to the chat when it isn't nil
+	sidebar *sidebar
+
+	// index in the session's messages of the message selected with
+	// ctrl+e. -1 when nothing is selected
+	selected int
+
+	// index of the prompt that's being edited in the prompt editor. -1
+	// when the editor is used for a new prompt
+	editing int
+
+	// indexes of the answers whose footnotes show the cited excerpts
+	expandedFootnotes map[int]bool
+
+	// set when the response starts a new branch. the whole history is
+	// rendered again once it's done
+	rerenderHistory bool
+
+	// name of the model the user is being asked to pull
+	pullConfirm string
+
+	// set while a model is being pulled. pulls counts the pulls that were
+	// started and gives each one its id
+	pull  *pullState
+	pulls int
+
+	// set while the user is asked whether the model may call a tool
+	toolApproval chan<- bool
+
+	// problems with the commands in the prompt. they're shown under it
+	diagnostics []command.Diagnostic
 }
 
-func New(session *llm.Session) Model {
-	return Model{
-		session: session,
+func New(
+	session *llm.Session,
+	personas []llm.Persona,
+	store *store.Store,
+) Model {
+	m := Model{
+		session:  session,
+		personas: personas,
+		store:    store,
+		selected: -1,
+		editing:  -1,
 	}
+	// a resumed session
+	m.renderHistory(-1)
+	return m
 }
 
 func (m Model) Init() tea.Cmd {
-	return nil
+	return tea.Batch(
+		checkHealth(m.session),
+		checkModel(m.session, m.session.Model()),
+	)
+}
+
+func checkModel(session *llm.Session, name string) tea.Cmd {
+	return func() tea.Msg {
+		details, err := session.CheckModel(context.Background(), name)
+		details.Name = name
+		return modelCheckedMsg{details, err}
+	}
+}
+
+func listModels(session *llm.Session) tea.Cmd {
+	return func() tea.Msg {
+		models, err := session.ListModels(context.Background())
+		return modelsListedMsg{models, err}
+	}
+}
+
+func (m *Model) onModelChecked(msg modelCheckedMsg) {
+	switch {
+	case errors.Is(msg.err, llm.ErrModelNotFound) && m.session.CanPullModels():
+		m.askToPull(msg.details.Name)
+	case errors.Is(msg.err, llm.ErrModelNotFound):
+		m.reportError(fmt.Errorf(
+			"%w. use /model to pick an installed model",
+			msg.err,
+		))
+	case errors.Is(msg.err, llm.ErrServerUnreachable):
+		m.reportError(fmt.Errorf(
+			"%w. check that it's running and the url is right",
+			msg.err,
+		))
+	case msg.err != nil:
+		m.reportError(msg.err)
+	default:
+		m.reportInfo("using " + msg.details.String())
+	}
+}
+
+func (m *Model) onModelsListed(msg modelsListedMsg) {
+	if msg.err != nil {
+		m.reportError(msg.err)
+		return
+	}
+
+	items := make([]pickerItem, len(msg.models))
+	for i, model := range msg.models {
+		items[i] = pickerItem{label: model.Name}
+		if model.Size > 0 {
+			items[i].detail = formatSize(model.Size)
+		}
+		if model.Name == m.session.Model() {
+			items[i].detail += " (current)"
+		}
+	}
+
+	m.picker = newPicker(
+		"Switch model",
+		items,
+		func(m *Model, item pickerItem) tea.Cmd {
+			return m.switchModel(item.label)
+		},
+	)
+}
+
+func (m *Model) switchModel(name string) tea.Cmd {
+	m.session.SetModel(name)
+	return checkModel(m.session, name)
+}
+
+func checkHealth(session *llm.Session) tea.Cmd {
+	return func() tea.Msg {
+		return healthMsg{session.Ping()}
+	}
+}
+
+func (m *Model) onHealthChecked(msg healthMsg) tea.Cmd {
+	// only report when the connection is lost, not every failed check
+	if msg.err != nil && m.healthErr == nil {
+		m.reportError(msg.err)
+	}
+	m.healthChecked = true
+	m.healthErr = msg.err
+
+	session := m.session
+	return tea.Tick(healthCheckInterval, func(time.Time) tea.Msg {
+		return checkHealth(session)()
+	})
 }
 
 func (m *Model) redrawViewport(content string) error {
@@ -79,19 +282,46 @@ func (m *Model) redrawViewport(content string) error {
 }
 
 func (m *Model) onPromptEntered(prompt string) (tea.Cmd, error) {
-	r, err := glamour.Render("User: "+prompt+"\n", glamourStyle)
-	if err != nil {
+	if isSlashCommand(prompt) {
+		return m.runSlashCommand(prompt)
+	}
+	if err := m.checkPrompt(prompt); err != nil {
 		return nil, err
 	}
-	m.messages += r
 
+	session := m.session
+	if index := m.editing; index >= 0 {
+		m.editing = -1
+		m.renderHistory(index)
+		if err := m.renderPrompt(prompt); err != nil {
+			return nil, err
+		}
+		return m.startResponse(func(ctx context.Context) (<-chan llm.Event, error) {
+			return session.EditPrompt(ctx, index, prompt)
+		}), nil
+	}
+
+	if err := m.renderPrompt(prompt); err != nil {
+		return nil, err
+	}
 	m.prompt.Blur()
 
 	return func() tea.Msg {
-		return llmResponseStartMsg{prompt}
+		return llmResponseStartMsg{func(ctx context.Context) (<-chan llm.Event, error) {
+			return session.SendPrompt(ctx, prompt)
+		}}
 	}, nil
 }
 
+func (m *Model) renderPrompt(prompt string) error {
+	r, err := glamour.Render("User: "+prompt+"\n", glamourStyle)
+	if err != nil {
+		return err
+	}
+	m.messages += r
+	return nil
+}
+
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var (
 		cmd  tea.Cmd
@@ -100,15 +330,76 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.picker != nil && msg.String() != "ctrl+c" {
+			return m, m.updatePicker(msg)
+		}
+		if m.toolApproval != nil && msg.String() != "ctrl+c" {
+			return m, m.onToolApprovalKey(msg)
+		}
+		if m.pullConfirm != "" && msg.String() != "ctrl+c" {
+			return m, m.onPullConfirmKey(msg)
+		}
+		if m.sidebar != nil && msg.String() != "ctrl+c" {
+			return m, m.updateSidebar(msg)
+		}
+		if m.selected >= 0 && msg.String() != "ctrl+c" {
+			return m, m.updateSelection(msg)
+		}
+
 		switch msg.String() {
 		case "ctrl+c":
 			return m, tea.Quit
 		case "enter":
 			m.prompt.Focus()
+		case "ctrl+o":
+			cmds = append(cmds, m.toggleSidebar())
+		case "ctrl+e":
+			m.startSelecting()
+		case "ctrl+x":
+			if !m.cancelPull() {
+				m.interruptLlmResponse()
+			}
 		case "esc":
-			m.prompt.Blur()
+			if m.cancelPull() {
+				break
+			}
+			if m.readingLlmResponse {
+				m.interruptLlmResponse()
+			} else {
+				m.cancelEditing()
+				m.prompt.Blur()
+			}
 		}
 
+	case healthMsg:
+		cmds = append(cmds, m.onHealthChecked(msg))
+
+	case modelCheckedMsg:
+		m.onModelChecked(msg)
+
+	case modelsListedMsg:
+		m.onModelsListed(msg)
+
+	case sessionSavedMsg:
+		if msg.err != nil {
+			m.reportError(msg.err)
+		}
+
+	case sessionsListedMsg:
+		m.onSessionsListed(msg)
+
+	case sidebarSessionsMsg:
+		m.onSidebarSessions(msg)
+
+	case sessionLoadedMsg:
+		cmds = append(cmds, m.onSessionLoaded(msg))
+
+	case pullProgressMsg:
+		cmds = append(cmds, m.onPullProgress(msg))
+
+	case pullFinishedMsg:
+		cmds = append(cmds, m.onPullFinished(msg))
+
 	case tea.WindowSizeMsg:
 		// TODO: handle promptView resizes
 		m.onWindowResize(msg)
@@ -123,28 +414,59 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.redrawViewport(m.messages)
 
 	case llmResponseStartMsg:
-		ch, err := m.session.SendPrompt(msg.prompt)
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := msg.send(ctx)
 		if err != nil {
+			cancel()
+			if m.rerenderHistory {
+				m.rerenderHistory = false
+				m.renderHistory(-1)
+			}
 			m.reportError(err)
+			if errors.Is(err, llm.ErrModelNotFound) && m.session.CanPullModels() {
+				m.askToPull(m.session.Model())
+			}
 		} else {
-			m.startReadingLlmResponse()
+			m.startReadingLlmResponse(cancel)
 			cmds = append(cmds, readResponse(ch))
 		}
 
-	case llmPartialResponseMsg:
+	case llmEventMsg:
 		if !m.readingLlmResponse {
-			panic("impossible state: m.readingLlmResponse must be set to true for llmPartialResponseMsg to be sent")
+			panic("impossible state: m.readingLlmResponse must be set to true for llmEventMsg to be sent")
 		}
 		if m.currentMessage == nil {
-			panic("impossible state: m.currentMessage must not be nil for llmPartialResponseMsg to be sent")
+			panic("impossible state: m.currentMessage must not be nil for llmEventMsg to be sent")
 		}
 
 		cmds = append(cmds, readResponse(msg.ch))
-		*m.currentMessage += msg.content
+
+		switch ev := msg.event.(type) {
+		case llm.Token:
+			*m.currentMessage += ev.Content
+		case llm.Thinking:
+			m.currentThinking += ev.Content
+		case llm.Error:
+			m.responseErr = ev.Err
+		case llm.Compacted:
+			m.compacted = &ev
+		case llm.Done:
+			m.lastStats = &ev.Stats
+		case llm.ToolRequested:
+			m.onToolRequested(ev)
+		case llm.ToolFinished:
+			m.onToolFinished(ev)
+		case llm.ResearchStep:
+			m.onResearchStep(ev)
+		}
 
 		// doing word wrapping here because sometimes the text can get too
 		// long for the screen
-		wrapped := m.wrapString(m.messages + *m.currentMessage)
+		wrapped := m.wrapString(
+			m.messages +
+				thinkingStyle.Render(m.currentThinking) +
+				*m.currentMessage,
+		)
 		m.redrawViewport(wrapped)
 
 	case llmResponseDoneMsg:
@@ -154,14 +476,42 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.currentMessage == nil {
 			panic("impossible state: m.currentMessage must not be nil for llmResponseDoneMsg to be sent")
 		}
-		r, err := glamour.Render(*m.currentMessage, glamourStyle)
-		if err != nil {
-			m.reportError(err)
+		if m.rerenderHistory {
+			m.rerenderHistory = false
+			m.renderHistory(-1)
 		} else {
-			m.messages += r
+			if m.interrupted || m.responseErr != nil {
+				*m.currentMessage += "\n\n*(interrupted)*"
+			}
+			r, err := glamour.Render(*m.currentMessage, glamourStyle)
+			if err != nil {
+				m.reportError(err)
+			} else {
+				m.messages += r
+				if messages := m.session.Messages(); len(messages) > 0 {
+					last := len(messages) - 1
+					m.renderFootnotes(last)
+					m.renderQuotes(messages[last].Quotes)
+				}
+			}
+		}
+		if m.responseErr != nil {
+			m.reportError(m.responseErr)
+		}
+		if c := m.compacted; c != nil && c.Err != nil {
+			m.reportError(c.Err)
+		} else if c != nil {
+			m.reportInfo(fmt.Sprintf(
+				"condensed %d earlier messages into a summary to stay within %d tokens",
+				c.Summarized,
+				m.session.TokenBudget(),
+			))
 		}
 		m.stopReadingLlmResponse()
 		m.redrawViewport(m.messages)
+
+		// interrupted answers are saved too since they're in the history
+		cmds = append(cmds, m.saveSession())
 	}
 
 	if !m.prompt.Focused() {
@@ -171,6 +521,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	m.prompt, cmd = m.prompt.Update(msg)
 	cmds = append(cmds, cmd)
+	if _, ok := msg.(tea.KeyMsg); ok {
+		m.updateDiagnostics()
+	}
 
 	return m, tea.Batch(cmds...)
 }
@@ -179,26 +532,44 @@ func (m *Model) wrapString(str string) string {
 	return wordwrap.String(str, m.viewport.Width-5)
 }
 
-func (m *Model) startReadingLlmResponse() {
+func (m *Model) startReadingLlmResponse(cancel context.CancelFunc) {
 	m.readingLlmResponse = true
 	m.currentMessage = new(string)
+	m.currentThinking = ""
+	m.responseErr = nil
+	m.compacted = nil
+	m.cancelResponse = cancel
+	m.interrupted = false
 	m.prompt.SetCanEnterMessage(false)
 }
 
 func (m *Model) stopReadingLlmResponse() {
+	// releases the context's resources if the response finished normally
+	m.cancelResponse()
+	m.cancelResponse = nil
 	m.currentMessage = nil
+	m.toolApproval = nil
 	m.readingLlmResponse = false
 	m.prompt.SetCanEnterMessage(true)
 }
 
-func readResponse(ch <-chan string) tea.Cmd {
+// interruptLlmResponse stops generation. the stream is still read until
+// it is closed so llmResponseDoneMsg is sent as usual
+func (m *Model) interruptLlmResponse() {
+	if !m.readingLlmResponse {
+		return
+	}
+	m.interrupted = true
+	m.cancelResponse()
+}
+
+func readResponse(ch <-chan llm.Event) tea.Cmd {
 	return func() tea.Msg {
-		msg, ok := <-ch
+		ev, ok := <-ch
 		if !ok {
 			return llmResponseDoneMsg{}
 		}
-		return llmPartialResponseMsg{content: msg, ch: ch}
-
+		return llmEventMsg{event: ev, ch: ch}
 	}
 }
 
@@ -210,15 +581,23 @@ func (m *Model) reportError(err error) {
 	m.redrawViewport(m.messages)
 }
 
+// reportInfo shows the output of a slash command
+func (m *Model) reportInfo(info string) {
+	m.messages += m.wrapString(
+		infoTextStyle.Render(strings.TrimRight(info, "\n")) + "\n",
+	)
+	m.redrawViewport(m.messages)
+}
+
 func (m Model) View() string {
 	if !m.ready {
 		return "\n Initializing..."
 	}
 	return fmt.Sprintf(
-		"%s\n%s\n%s",
+		"%s\n%s\n%s\n%s",
 		m.headerView(),
 		m.chatView(),
-		// m.footerView(),
+		m.footerView(),
 		m.promptView(),
 	)
 }
@@ -228,6 +607,8 @@ func (m *Model) onWindowResize(ws tea.WindowSizeMsg) {
 	footerHeight := lg.Height(m.footerView())
 	verticalMarginHeight := headerHeight + footerHeight
 
+	m.width = ws.Width
+	m.height = ws.Height
 	viewportWidth := ws.Width
 
 	if !m.ready {
@@ -248,34 +629,156 @@ func (m *Model) onWindowResize(ws tea.WindowSizeMsg) {
 		// BorderForeground(lg.Color("62")).
 		// Padding(2).Margin(10)
 
+		// anything reported before the first resize
+		m.redrawViewport(m.messages)
+
 		m.ready = true
 	} else {
-		viewportHeight :=
-			ws.Height - (verticalMarginHeight + lg.Height(m.promptView()))
+		m.resizeViewport()
+	}
+	m.layout()
+}
+
+// resizeViewport gives the viewport whatever height the header, footer and
+// prompt leave. the prompt grows when there are diagnostics under it
+func (m *Model) resizeViewport() {
+	if !m.ready {
+		return
+	}
+	margin := lg.Height(m.headerView()) + lg.Height(m.footerView())
+	m.viewport.Height = max(0, m.height-(margin+lg.Height(m.promptView())))
+}
 
-		m.viewport.Height = viewportHeight
-		m.viewport.Width = viewportWidth
+// layout makes room for the sidebar when it's open
+func (m *Model) layout() {
+	if !m.ready {
+		return
+	}
+	m.viewport.Width = m.width
+	if m.sidebar != nil {
+		m.viewport.Width = max(0, m.width-sidebarWidth)
 	}
 }
 
 func (m *Model) headerView() string {
 	title := titleStyle.Render("Research")
-	line := strings.Repeat("-", max(0, m.viewport.Width-lg.Width(title)))
-	return lg.JoinHorizontal(lg.Center, title, line)
+	status := m.session.Model()
+	if persona := m.session.Persona(); persona != "" {
+		status = persona + " · " + status
+	}
+	if options := m.session.Options().String(); options != "" {
+		status += " · " + options
+	}
+	status = titleStyle.Render(status + " " + m.healthView())
+	line := strings.Repeat(
+		"-",
+		max(0, m.width-lg.Width(title)-lg.Width(status)),
+	)
+	return lg.JoinHorizontal(lg.Center, title, line, status)
+}
+
+func (m *Model) healthView() string {
+	switch {
+	case !m.healthChecked:
+		return "○ connecting"
+	case m.healthErr != nil:
+		return offlineStyle.Render("● offline")
+	default:
+		return onlineStyle.Render("● online")
+	}
 }
 
 func (m *Model) chatView() string {
-	return m.viewport.View()
+	chat := m.viewport.View()
+	if m.picker != nil {
+		chat = m.viewport.Style.Render(m.picker.view(
+			m.viewport.Width-m.viewport.Style.GetHorizontalFrameSize(),
+			m.viewport.Height-m.viewport.Style.GetVerticalFrameSize(),
+		))
+	}
+
+	if m.sidebar != nil {
+		side := m.sidebar.view(sidebarWidth, m.viewport.Height)
+		return lg.JoinHorizontal(lg.Top, side, chat)
+	}
+	return chat
 }
 
 func (m *Model) footerView() string {
 	info := infoStyle.Render(
 		fmt.Sprintf("%3.f%%", m.viewport.ScrollPercent()*100),
 	)
-	line := strings.Repeat("-", max(0, m.viewport.Width-lg.Width(info)))
-	return lg.JoinHorizontal(lg.Center, info, line)
+
+	if m.pull != nil {
+		pull := m.pullView(m.width - lg.Width(info))
+		return lg.JoinHorizontal(lg.Center, pull, info)
+	}
+
+	// always render something so the footer's height doesn't change
+	stats := "no responses yet"
+	if m.lastStats != nil {
+		stats = formatStats(*m.lastStats)
+	}
+
+	usage := fmt.Sprintf(
+		"context ~%d/%d",
+		m.session.ContextUsage(),
+		m.session.TokenBudget(),
+	)
+	if m.session.Condensed() {
+		usage += " (condensed)"
+	}
+	stats = infoStyle.Render(stats + " · " + usage)
+
+	line := strings.Repeat(
+		"-",
+		max(0, m.width-lg.Width(info)-lg.Width(stats)),
+	)
+	return lg.JoinHorizontal(lg.Center, stats, line, info)
+}
+
+// formatStats only shows what the server reported
+func formatStats(s llm.Stats) string {
+	var parts []string
+	if tps := s.TokensPerSecond(); tps > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f tok/s", tps))
+	}
+	if s.EvalCount > 0 {
+		parts = append(parts, fmt.Sprintf("%d tokens", s.EvalCount))
+	}
+	if s.PromptEvalCount > 0 {
+		prompt := fmt.Sprintf("prompt %d tokens", s.PromptEvalCount)
+		if s.PromptEvalDuration > 0 {
+			prompt += " in " + s.PromptEvalDuration.Round(time.Millisecond).String()
+		}
+		parts = append(parts, prompt)
+	}
+	// loading an already loaded model still takes a few milliseconds
+	if s.LoadDuration > 100*time.Millisecond {
+		parts = append(parts, "load "+s.LoadDuration.Round(time.Millisecond).String())
+	}
+	parts = append(parts, "took "+s.Duration.Round(10*time.Millisecond).String())
+
+	return strings.Join(parts, " · ")
+}
+
+// formatSize formats n bytes e.g. 4.1 GB
+func formatSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for i := n / unit; i >= unit; i /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
 }
 
 func (m *Model) promptView() string {
-	return m.prompt.View()
+	if len(m.diagnostics) == 0 {
+		return m.prompt.View()
+	}
+	return m.prompt.View() + "\n" + m.diagnosticsView()
 }
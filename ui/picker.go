@@ -0,0 +1,101 @@
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	lg "github.com/charmbracelet/lipgloss"
+)
+
+var (
+	pickerStyle = lg.NewStyle().
+			BorderStyle(lg.RoundedBorder()).
+			Padding(0, 1)
+
+	pickerCursorStyle = lg.NewStyle().Bold(true).Foreground(lg.Color("12"))
+)
+
+type pickerItem struct {
+	label  string
+	detail string
+}
+
+// picker is an overlay that lets the user choose one of several items.
+// while it's open it gets every key press
+type picker struct {
+	title  string
+	items  []pickerItem
+	cursor int
+
+	// called with the item that was picked
+	onPick func(m *Model, item pickerItem) tea.Cmd
+}
+
+func newPicker(
+	title string,
+	items []pickerItem,
+	onPick func(m *Model, item pickerItem) tea.Cmd,
+) *picker {
+	return &picker{
+		title:  title,
+		items:  items,
+		onPick: onPick,
+	}
+}
+
+// updatePicker closes the picker when an item is picked or esc is pressed
+func (m *Model) updatePicker(msg tea.KeyMsg) tea.Cmd {
+	p := m.picker
+
+	switch msg.String() {
+	case "up", "k", "ctrl+p":
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case "down", "j", "ctrl+n":
+		if p.cursor < len(p.items)-1 {
+			p.cursor++
+		}
+	case "esc", "q":
+		m.picker = nil
+	case "enter":
+		m.picker = nil
+		if len(p.items) > 0 {
+			return p.onPick(m, p.items[p.cursor])
+		}
+	}
+	return nil
+}
+
+func (p *picker) view(width, height int) string {
+	b := strings.Builder{}
+	b.WriteString(p.title + "\n\n")
+
+	// keep the cursor in view when there are more items than lines
+	visible := max(1, height-6)
+	start := max(0, min(p.cursor-visible/2, len(p.items)-visible))
+	end := min(len(p.items), start+visible)
+
+	for i := start; i < end; i++ {
+		item := p.items[i]
+		line := "  " + item.label
+		if item.detail != "" {
+			line += "  " + infoTextStyle.Render(item.detail)
+		}
+		if i == p.cursor {
+			line = pickerCursorStyle.Render("> " + item.label)
+			if item.detail != "" {
+				line += "  " + infoTextStyle.Render(item.detail)
+			}
+		}
+		b.WriteString(line + "\n")
+	}
+	if len(p.items) == 0 {
+		b.WriteString(infoTextStyle.Render("nothing to pick from") + "\n")
+	}
+
+	b.WriteString("\n" + infoTextStyle.Render("enter to pick, esc to close"))
+
+	box := pickerStyle.MaxWidth(width).Render(b.String())
+	return lg.Place(width, height, lg.Center, lg.Center, box)
+}
@@ -273,6 +273,20 @@ func (m *Model) clear() {
 	m.redraw()
 }
 
+// SetValue replaces the prompt's content with s and moves the cursor to
+// the end of it
+func (m *Model) SetValue(s string) {
+	m.clear()
+	for i, text := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		if i > 0 {
+			m.insertLine()
+			m.currentLine++
+		}
+		m.writeRunes([]rune(text))
+	}
+	m.redraw()
+}
+
 func (m *Model) Focus() {
 	if !m.focused {
 		m.justFocused = true
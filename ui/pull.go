@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+	"github.com/charmbracelet/bubbles/progress"
+	tea "github.com/charmbracelet/bubbletea"
+	lg "github.com/charmbracelet/lipgloss"
+)
+
+// pull messages carry the id of the pull they belong to so that messages of
+// a pull that's no longer m.pull are dropped
+type pullProgressMsg struct {
+	id       int
+	progress llm.PullProgress
+	ch       <-chan llm.PullProgress
+}
+
+// pullFinishedMsg is sent when the pull's progress channel is closed or
+// the pull couldn't be started
+type pullFinishedMsg struct {
+	id  int
+	err error
+}
+
+// pullState is set while a model is being downloaded
+type pullState struct {
+	id       int
+	name     string
+	progress llm.PullProgress
+	bar      progress.Model
+	cancel   context.CancelFunc
+
+	// the error sent by the server if the pull failed
+	err error
+}
+
+// askToPull asks the user whether name should be downloaded. the answer
+// is handled by onPullConfirmKey
+func (m *Model) askToPull(name string) {
+	if m.pull != nil {
+		m.reportInfo(fmt.Sprintf("%s isn't installed. already pulling %s", name, m.pull.name))
+		return
+	}
+	m.pullConfirm = name
+	m.reportInfo(fmt.Sprintf("%s isn't installed. pull it? (y/n)", name))
+}
+
+func (m *Model) onPullConfirmKey(msg tea.KeyMsg) tea.Cmd {
+	name := m.pullConfirm
+
+	switch msg.String() {
+	case "y", "Y":
+		m.pullConfirm = ""
+		return m.startPull(name)
+	case "n", "N", "esc":
+		m.pullConfirm = ""
+		m.reportInfo("not pulling " + name)
+	}
+	return nil
+}
+
+// startPull refuses to start a second pull since there's only room for one
+// progress bar
+func (m *Model) startPull(name string) tea.Cmd {
+	if m.pull != nil {
+		m.reportInfo("already pulling " + m.pull.name)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.pulls++
+	id := m.pulls
+	m.pull = &pullState{
+		id:     id,
+		name:   name,
+		bar:    progress.New(progress.WithDefaultGradient()),
+		cancel: cancel,
+	}
+	m.pull.progress.Status = "starting"
+
+	session := m.session
+	return func() tea.Msg {
+		ch, err := session.PullModel(ctx, name)
+		if err != nil {
+			return pullFinishedMsg{id: id, err: err}
+		}
+		return readPullProgress(id, ch)()
+	}
+}
+
+func readPullProgress(id int, ch <-chan llm.PullProgress) tea.Cmd {
+	return func() tea.Msg {
+		p, ok := <-ch
+		if !ok {
+			return pullFinishedMsg{id: id}
+		}
+		return pullProgressMsg{id: id, progress: p, ch: ch}
+	}
+}
+
+func (m *Model) onPullProgress(msg pullProgressMsg) tea.Cmd {
+	if m.pull == nil || m.pull.id != msg.id {
+		// the channel is still drained so the stale pull's goroutine
+		// doesn't block
+		return readPullProgress(msg.id, msg.ch)
+	}
+
+	if msg.progress.Err != nil {
+		m.pull.err = msg.progress.Err
+	} else {
+		m.pull.progress = msg.progress
+	}
+	return readPullProgress(msg.id, msg.ch)
+}
+
+func (m *Model) onPullFinished(msg pullFinishedMsg) tea.Cmd {
+	if m.pull == nil || m.pull.id != msg.id {
+		return nil
+	}
+
+	pull := m.pull
+	pull.cancel()
+	m.pull = nil
+
+	err := msg.err
+	if err == nil {
+		err = pull.err
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		m.reportInfo("cancelled pulling " + pull.name)
+	case err != nil:
+		m.reportError(fmt.Errorf("Failed to pull %s: %w", pull.name, err))
+	case pull.progress.Status != "success":
+		m.reportInfo("cancelled pulling " + pull.name)
+	default:
+		m.reportInfo("pulled " + pull.name)
+		return checkModel(m.session, m.session.Model())
+	}
+	return nil
+}
+
+// cancelPull returns false if there is no pull to cancel
+func (m *Model) cancelPull() bool {
+	if m.pull == nil {
+		return false
+	}
+	m.pull.cancel()
+	return true
+}
+
+func (m *Model) pullView(width int) string {
+	p := m.pull.progress
+	label := fmt.Sprintf("pulling %s: %s ", m.pull.name, p.Status)
+	if p.Total > 0 {
+		label += fmt.Sprintf(
+			"%s/%s ",
+			formatSize(p.Completed),
+			formatSize(p.Total),
+		)
+	}
+
+	m.pull.bar.Width = max(10, width-lg.Width(label)-infoStyle.GetHorizontalFrameSize())
+	return infoStyle.Render(label + m.pull.bar.ViewAs(p.Fraction()))
+}
@@ -0,0 +1,34 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+)
+
+// onResearchStep shows how far a research run has got
+func (m *Model) onResearchStep(ev llm.ResearchStep) {
+	switch {
+	case ev.Err != nil:
+		m.reportInfo(fmt.Sprintf("skipping %s: %v", ev.Detail, ev.Err))
+	case ev.Stage == llm.StagePlan && ev.Detail == "":
+		m.reportInfo("planning the research")
+	case ev.Stage == llm.StagePlan:
+		m.reportInfo("  " + ev.Detail)
+	case ev.Stage == llm.StageGather:
+		m.reportInfo("reading " + ev.Detail)
+	case ev.Stage == llm.StageSummarize:
+		m.reportInfo("summarizing " + ev.Detail)
+	case ev.Stage == llm.StageWrite:
+		m.reportInfo("writing the report")
+	}
+}
+
+// renderResearchRun shows a saved run before its report
+func (m *Model) renderResearchRun(run *llm.ResearchRun) {
+	m.reportInfo(fmt.Sprintf(
+		"researched %d questions using %d sources",
+		len(run.Questions),
+		len(run.Sources),
+	))
+}
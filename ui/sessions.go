@@ -0,0 +1,107 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+	"github.com/Hassan-Ibrahim-1/research/store"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type sessionSavedMsg struct {
+	err error
+}
+
+type sessionsListedMsg struct {
+	snaps []llm.Snapshot
+	err   error
+}
+
+type sessionLoadedMsg struct {
+	snap llm.Snapshot
+	err  error
+}
+
+// saveSession writes the session to the store. empty sessions aren't saved
+// so opening and closing the app doesn't leave files behind
+func (m *Model) saveSession() tea.Cmd {
+	if m.store == nil {
+		return nil
+	}
+	snap := m.session.Snapshot()
+	if len(snap.Messages) == 0 {
+		return nil
+	}
+
+	s := m.store
+	return func() tea.Msg {
+		return sessionSavedMsg{s.Save(snap)}
+	}
+}
+
+func listSessions(s *store.Store) tea.Cmd {
+	return func() tea.Msg {
+		snaps, err := s.List()
+		return sessionsListedMsg{snaps, err}
+	}
+}
+
+func loadSession(s *store.Store, id string) tea.Cmd {
+	return func() tea.Msg {
+		snap, err := s.Load(id)
+		return sessionLoadedMsg{snap, err}
+	}
+}
+
+func (m *Model) onSessionsListed(msg sessionsListedMsg) {
+	if msg.err != nil {
+		m.reportError(msg.err)
+		return
+	}
+
+	items := make([]pickerItem, len(msg.snaps))
+	for i, snap := range msg.snaps {
+		items[i] = pickerItem{
+			label: snap.ID,
+			detail: fmt.Sprintf(
+				"%s · %d messages · %s",
+				snap.Model,
+				len(snap.Messages),
+				snap.DisplayTitle(),
+			),
+		}
+		if snap.ID == m.session.ID() {
+			items[i].detail += " (current)"
+		}
+	}
+
+	s := m.store
+	m.picker = newPicker(
+		"Resume session",
+		items,
+		func(m *Model, item pickerItem) tea.Cmd {
+			return loadSession(s, item.label)
+		},
+	)
+}
+
+func (m *Model) onSessionLoaded(msg sessionLoadedMsg) tea.Cmd {
+	if msg.err != nil {
+		m.reportError(msg.err)
+		return nil
+	}
+	if m.readingLlmResponse {
+		m.reportError(fmt.Errorf("Can't resume a session while a response is being read"))
+		return nil
+	}
+
+	m.session.Restore(msg.snap)
+	m.messages = ""
+	m.lastStats = nil
+	m.stopSelecting()
+	m.editing = -1
+	m.renderHistory(-1)
+	m.reportInfo("resumed " + msg.snap.ID)
+
+	return checkModel(m.session, m.session.Model())
+}
@@ -0,0 +1,168 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+	"github.com/Hassan-Ibrahim-1/research/store"
+	tea "github.com/charmbracelet/bubbletea"
+	lg "github.com/charmbracelet/lipgloss"
+)
+
+const sidebarWidth = 36
+
+var sidebarStyle = lg.NewStyle().
+	BorderStyle(lg.RoundedBorder()).
+	Padding(0, 1)
+
+// sidebar lists saved sessions next to the chat. while it's open it gets
+// every key press, typing filters the list
+type sidebar struct {
+	sessions []llm.Snapshot
+	filtered []llm.Snapshot
+	query    string
+	cursor   int
+
+	// false until the sessions are listed
+	loaded bool
+}
+
+type sidebarSessionsMsg struct {
+	snaps []llm.Snapshot
+	err   error
+}
+
+func listSidebarSessions(s *store.Store) tea.Cmd {
+	return func() tea.Msg {
+		snaps, err := s.List()
+		return sidebarSessionsMsg{snaps, err}
+	}
+}
+
+func (m *Model) toggleSidebar() tea.Cmd {
+	if m.sidebar != nil {
+		m.sidebar = nil
+		m.layout()
+		return nil
+	}
+	if m.store == nil {
+		m.reportError(fmt.Errorf("Sessions aren't being saved"))
+		return nil
+	}
+
+	m.sidebar = &sidebar{}
+	m.layout()
+	return listSidebarSessions(m.store)
+}
+
+func (m *Model) onSidebarSessions(msg sidebarSessionsMsg) {
+	if m.sidebar == nil {
+		return
+	}
+	if msg.err != nil {
+		m.sidebar = nil
+		m.layout()
+		m.reportError(msg.err)
+		return
+	}
+	m.sidebar.sessions = msg.snaps
+	m.sidebar.loaded = true
+	m.sidebar.filter()
+}
+
+func (s *sidebar) filter() {
+	s.filtered = store.Filter(s.sessions, s.query)
+	s.cursor = 0
+}
+
+// updateSidebar resumes the selected session on enter and closes the
+// sidebar on esc
+func (m *Model) updateSidebar(msg tea.KeyMsg) tea.Cmd {
+	s := m.sidebar
+
+	switch msg.Type {
+	case tea.KeyUp, tea.KeyCtrlP:
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case tea.KeyDown, tea.KeyCtrlN:
+		if s.cursor < len(s.filtered)-1 {
+			s.cursor++
+		}
+	case tea.KeyEsc, tea.KeyCtrlO:
+		return m.toggleSidebar()
+	case tea.KeyEnter:
+		if len(s.filtered) == 0 {
+			return nil
+		}
+		id := s.filtered[s.cursor].ID
+		m.toggleSidebar()
+		return loadSession(m.store, id)
+	case tea.KeyBackspace:
+		if r := []rune(s.query); len(r) > 0 {
+			s.query = string(r[:len(r)-1])
+			s.filter()
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		s.query += string(msg.Runes)
+		s.filter()
+	}
+	return nil
+}
+
+func (s *sidebar) view(width, height int) string {
+	// the border and padding
+	inner := width - 4
+
+	b := strings.Builder{}
+	b.WriteString("History\n")
+	b.WriteString(infoTextStyle.Render("filter: ") + s.query + "▏\n\n")
+
+	// each session takes two lines
+	visible := max(1, (height-7)/2)
+	start := max(0, min(s.cursor-visible/2, len(s.filtered)-visible))
+	end := min(len(s.filtered), start+visible)
+
+	for i := start; i < end; i++ {
+		snap := s.filtered[i]
+		title := truncate(snap.DisplayTitle(), inner-2)
+		detail := truncate(fmt.Sprintf(
+			"%s · %s · %d msgs",
+			snap.Model,
+			snap.Updated.Local().Format("Jan 2 15:04"),
+			len(snap.Messages),
+		), inner-2)
+
+		if i == s.cursor {
+			b.WriteString(pickerCursorStyle.Render("> "+title) + "\n")
+		} else {
+			b.WriteString("  " + title + "\n")
+		}
+		b.WriteString("  " + infoTextStyle.Render(detail) + "\n")
+	}
+
+	switch {
+	case !s.loaded:
+		b.WriteString(infoTextStyle.Render("loading...") + "\n")
+	case len(s.sessions) == 0:
+		b.WriteString(infoTextStyle.Render("no saved sessions") + "\n")
+	case len(s.filtered) == 0:
+		b.WriteString(infoTextStyle.Render("no matches") + "\n")
+	}
+
+	return sidebarStyle.
+		Width(width - 2).
+		Height(height - 2).
+		MaxHeight(height).
+		Render(b.String())
+}
+
+// truncate cuts s to n runes
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:max(0, n-1)]) + "…"
+}
@@ -0,0 +1,64 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/Hassan-Ibrahim-1/research/llm"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// onToolRequested shows the call and asks the user to approve it if the
+// session is waiting for an answer. the answer is handled by
+// onToolApprovalKey
+func (m *Model) onToolRequested(ev llm.ToolRequested) {
+	if ev.Approve == nil {
+		m.reportInfo("calling " + ev.Call.String())
+		return
+	}
+	m.toolApproval = ev.Approve
+	m.reportInfo(fmt.Sprintf(
+		"the model wants to call %s. allow it? (y/n, a allows every call)",
+		ev.Call,
+	))
+}
+
+func (m *Model) onToolApprovalKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "y", "Y":
+		m.answerToolRequest(true)
+	case "a", "A":
+		m.session.SetConfirmTools(false)
+		m.answerToolRequest(true)
+	case "n", "N", "esc":
+		m.answerToolRequest(false)
+	case "ctrl+x":
+		m.toolApproval = nil
+		m.interruptLlmResponse()
+	}
+	return nil
+}
+
+// the reply channel is buffered so this never blocks
+func (m *Model) answerToolRequest(approved bool) {
+	m.toolApproval <- approved
+	m.toolApproval = nil
+}
+
+func (m *Model) onToolFinished(ev llm.ToolFinished) {
+	if ev.Err != nil {
+		m.reportInfo(fmt.Sprintf("%s failed: %v", ev.Call.Name, ev.Err))
+		return
+	}
+	m.reportInfo(fmt.Sprintf("%s returned %s", ev.Call.Name, formatSize(int64(len(ev.Output)))))
+}
+
+// renderToolMessage shows a tool call or result from the history the same
+// way they're shown while the answer is streamed
+func (m *Model) renderToolMessage(msg llm.Message) {
+	for _, call := range msg.ToolCalls {
+		m.reportInfo("calling " + call.String())
+	}
+	if msg.Role == llm.RoleTool {
+		m.reportInfo(fmt.Sprintf("%s returned %s", msg.ToolName, formatSize(int64(len(msg.Content)))))
+	}
+}